@@ -19,6 +19,7 @@ import (
 	"time"
 
 	"github.com/briggySmalls/flipdot/app/internal/button"
+	"github.com/briggySmalls/flipdot/app/internal/hanover"
 	"github.com/briggySmalls/flipdot/app/internal/protos"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -38,16 +39,25 @@ This application is a tool to generate the needed files
 to quickly create a Cobra application.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		// Get config
+		viper.BindPFlags(cmd.Flags())
 		config := getAppConfig()
-		// Create a gRPC connection to the remote flipdot server
-		connection, err := grpc.Dial(fmt.Sprintf(config.clientAddress), grpc.WithInsecure())
-		errorHandler(err)
-		// Create a flipdot client
-		client := protos.NewDriverClient(connection)
 		// Activate RPi GPIO
-		err = rpio.Open()
+		err := rpio.Open()
 		errorHandler(err)
 		defer rpio.Close()
+		var client protos.DriverClient
+		if config.serialPort != "" {
+			// Drive the signs directly over serial
+			var cleanup func()
+			client, cleanup = createSerialDriver(config)
+			defer cleanup()
+		} else {
+			// Create a gRPC connection to the remote flipdot server
+			connection, err := grpc.Dial(config.clientAddress, grpc.WithInsecure())
+			errorHandler(err)
+			// Create a flipdot client
+			client = protos.NewDriverClient(connection)
+		}
 		// Create pins that interface with RPi GPIO
 		ledPin := button.NewOutputPin(config.ledPin)
 		buttonPin := button.NewTriggerPin(config.buttonPin)
@@ -66,6 +76,10 @@ func init() {
 	flags.StringP("client-address", "c", "localhost:5001", "address used to connect to flipdot service")
 	flags.Uint8("button-pin", 0, "GPIO pin that reads button state")
 	flags.Uint8("led-pin", 0, "GPIO pin that illuminates button")
+	flags.String("serial-port", "", "serial port to drive signs over directly (instead of the flipdot service)")
+	flags.Int("serial-baud", 9600, "baud rate of the serial port")
+	flags.Uint8("sign-pin", 0, "GPIO pin that powers the signs (when driving over serial)")
+	flags.Uint8("light-pin", 0, "GPIO pin that powers the light (when driving over serial)")
 }
 
 func getAppConfig() config {
@@ -76,22 +90,45 @@ func getAppConfig() config {
 	clientAddress := viper.GetString("client-address")
 	buttonPin := viper.GetInt("button-pin")
 	ledPin := viper.GetInt("led-pin")
+	serialPort := viper.GetString("serial-port")
+	serialBaud := viper.GetInt("serial-baud")
+	signPin := viper.GetInt("sign-pin")
+	lightPin := viper.GetInt("light-pin")
 
 	// Validate additional config
-	if clientAddress == "" {
+	if clientAddress == "" && serialPort == "" {
 		errorHandler(fmt.Errorf("client-address cannot be: %s", clientAddress))
 	}
+	var signs []hanover.Sign
+	if serialPort != "" {
+		if serialBaud <= 0 {
+			errorHandler(fmt.Errorf("serial-baud cannot be: %d", serialBaud))
+		}
+		signs = getSigns()
+	}
 
 	// Print additional app config
 	fmt.Printf("APP CONFIG")
 	fmt.Printf("client-address: %s\n", clientAddress)
 	fmt.Printf("button-pin: %d\n", buttonPin)
 	fmt.Printf("led-pin: %d\n", ledPin)
+	fmt.Printf("serial-port: %s\n", serialPort)
+	fmt.Printf("serial-baud: %d\n", serialBaud)
+	fmt.Printf("sign-pin: %d\n", signPin)
+	fmt.Printf("light-pin: %d\n", lightPin)
+	for _, sign := range signs {
+		fmt.Printf("sign: %+v\n", sign)
+	}
 
 	// Update config
 	config.clientAddress = clientAddress
 	config.buttonPin = uint8(buttonPin)
 	config.ledPin = uint8(ledPin)
+	config.serialPort = serialPort
+	config.serialBaud = serialBaud
+	config.signPin = uint8(signPin)
+	config.lightPin = uint8(lightPin)
+	config.signs = signs
 
 	return config
 }
@@ -0,0 +1,152 @@
+// Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flipapp
+
+import (
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/briggySmalls/flipdot/app/internal/driver"
+	"github.com/briggySmalls/flipdot/app/internal/protos"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	rpio "github.com/stianeikeland/go-rpio/v4"
+)
+
+// driverCmd represents the driver command
+var driverCmd = &cobra.Command{
+	Use:   "driver",
+	Short: "Serve the flipdot driver service",
+	Long: `Serves the Driver gRPC service that the flipdot application talks to
+
+Signs can be backed by memory (logging what is drawn), a directory of PNG images, or
+Hanover signs attached to a serial port. This allows the whole system to run without
+the Python driver, or without any hardware at all.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Get config
+		viper.BindPFlags(cmd.Flags())
+		config := getDriverConfig()
+		// Create the backend
+		var backend protos.DriverClient
+		switch config.backend {
+		case "memory":
+			backend = driver.NewMemoryDriver(getSignsInfo(config))
+		case "png":
+			backend = driver.NewPngDriver(getSignsInfo(config), config.pngDir, config.pngScale)
+		case "serial":
+			if config.signPin != 0 || config.lightPin != 0 {
+				// Activate RPi GPIO
+				err := rpio.Open()
+				errorHandler(err)
+				defer rpio.Close()
+			}
+			var cleanup func()
+			backend, cleanup = createSerialDriver(config)
+			defer cleanup()
+		}
+		// Serve the driver
+		server := driver.NewRpcServer(backend)
+		lis, err := net.Listen("tcp", config.driverAddress)
+		errorHandler(err)
+		if err := server.Serve(lis); err != nil {
+			log.Fatalf("failed to serve: %s", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(driverCmd)
+
+	flags := driverCmd.Flags()
+	flags.String("driver-address", "0.0.0.0:5001", "address used to expose the driver service over")
+	flags.String("backend", "memory", "backend that draws images (memory, png or serial)")
+	flags.String("png-dir", ".", "directory to write images to (png backend)")
+	flags.Int("png-scale", 4, "size of each dot in written images (png backend)")
+	flags.String("serial-port", "", "serial port the signs are attached to (serial backend)")
+	flags.Int("serial-baud", 9600, "baud rate of the serial port (serial backend)")
+	flags.Uint8("sign-pin", 0, "GPIO pin that powers the signs (serial backend)")
+	flags.Uint8("light-pin", 0, "GPIO pin that powers the light (serial backend)")
+}
+
+func getDriverConfig() (config config) {
+	driverAddress := viper.GetString("driver-address")
+	backend := viper.GetString("backend")
+	pngDir := viper.GetString("png-dir")
+	pngScale := viper.GetInt("png-scale")
+	serialPort := viper.GetString("serial-port")
+	serialBaud := viper.GetInt("serial-baud")
+	signPin := viper.GetInt("sign-pin")
+	lightPin := viper.GetInt("light-pin")
+	signs := getSigns()
+
+	// Validate config
+	if driverAddress == "" {
+		errorHandler(fmt.Errorf("driver-address cannot be: %s", driverAddress))
+	}
+	switch backend {
+	case "memory":
+	case "png":
+		if pngScale <= 0 {
+			errorHandler(fmt.Errorf("png-scale cannot be: %d", pngScale))
+		}
+	case "serial":
+		if serialPort == "" {
+			errorHandler(fmt.Errorf("serial-port cannot be: %s", serialPort))
+		}
+		if serialBaud <= 0 {
+			errorHandler(fmt.Errorf("serial-baud cannot be: %d", serialBaud))
+		}
+	default:
+		errorHandler(fmt.Errorf("backend cannot be: %s", backend))
+	}
+
+	fmt.Println("")
+	fmt.Println("Starting driver with the following configuration:")
+	fmt.Printf("driver-address: %s\n", driverAddress)
+	fmt.Printf("backend: %s\n", backend)
+	fmt.Printf("png-dir: %s\n", pngDir)
+	fmt.Printf("png-scale: %d\n", pngScale)
+	fmt.Printf("serial-port: %s\n", serialPort)
+	fmt.Printf("serial-baud: %d\n", serialBaud)
+	fmt.Printf("sign-pin: %d\n", signPin)
+	fmt.Printf("light-pin: %d\n", lightPin)
+	for _, sign := range signs {
+		fmt.Printf("sign: %+v\n", sign)
+	}
+
+	config.driverAddress = driverAddress
+	config.backend = backend
+	config.pngDir = pngDir
+	config.pngScale = pngScale
+	config.serialPort = serialPort
+	config.serialBaud = serialBaud
+	config.signPin = uint8(signPin)
+	config.lightPin = uint8(lightPin)
+	config.signs = signs
+	return
+}
+
+// Get information on the configured signs, as reported by the driver service
+func getSignsInfo(config config) (signs []*protos.GetInfoResponse_SignInfo) {
+	for _, sign := range config.signs {
+		signs = append(signs, &protos.GetInfoResponse_SignInfo{
+			Name:   sign.Name,
+			Width:  uint32(sign.Width),
+			Height: uint32(sign.Height),
+		})
+	}
+	return
+}
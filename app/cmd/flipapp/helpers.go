@@ -1,6 +1,8 @@
 package flipapp
 
 import (
+	"context"
+	"fmt"
 	"image"
 	"image/png"
 	"io/ioutil"
@@ -8,21 +10,31 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/briggySmalls/flipdot/app/internal/button"
+	"github.com/briggySmalls/flipdot/app/internal/hanover"
 	"github.com/briggySmalls/flipdot/app/internal/imaging"
+	"github.com/briggySmalls/flipdot/app/internal/mode"
 	"github.com/briggySmalls/flipdot/app/internal/protos"
 	"github.com/briggySmalls/flipdot/app/internal/server"
 	"github.com/briggySmalls/flipdot/app/internal/text"
+	"github.com/spf13/viper"
 	"golang.org/x/image/font"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/reflection"
 )
 
-func createServer(appSecret, appPassword string, tokenExpiry time.Duration, messagesIn chan protos.MessageRequest, signsInfo []*protos.GetInfoResponse_SignInfo) (grpcServer *grpc.Server) {
+func createServer(ctx context.Context, appSecret, appPassword string, tokenExpiry time.Duration, messagesIn chan protos.MessageRequest, queueManager server.QueueManager, modeManager server.ModeManager, eventSource server.EventSource, signController server.SignController, signsInfo []*protos.GetInfoResponse_SignInfo) (grpcServer *grpc.Server) {
 	grpcServer = server.NewRpcServer(
+		ctx,
 		appSecret,
 		appPassword,
 		tokenExpiry,
 		messagesIn,
+		queueManager,
+		modeManager,
+		eventSource,
+		signController,
 		signsInfo,
 	)
 	// Register reflection service on gRPC server (for debugging).
@@ -30,20 +42,82 @@ func createServer(appSecret, appPassword string, tokenExpiry time.Duration, mess
 	return
 }
 
-func createImager(imageFile string, font font.Face, width, height, signCount uint) (imager imaging.Imager, err error) {
+// Create a driver for signs attached directly to a serial port (GPIO must already be open if pins are used)
+func createSerialDriver(config config) (client protos.DriverClient, cleanup func()) {
+	port, err := hanover.OpenPort(config.serialPort, config.serialBaud)
+	errorHandler(err)
+	var lightPin, signPin button.OutputPin
+	if config.lightPin != 0 {
+		lightPin = button.NewOutputPin(config.lightPin)
+	}
+	if config.signPin != 0 {
+		// Power the signs whilst we run
+		signPin = button.NewOutputPin(config.signPin)
+		signPin.High()
+	}
+	cleanup = func() {
+		if signPin != nil {
+			signPin.Low()
+		}
+		port.Close()
+	}
+	client = hanover.NewDriver(port, config.signs, lightPin)
+	return
+}
+
+// Create a client for a running application, authenticated using the configured password
+func createAppClient() (client protos.AppClient, ctx context.Context, cancel context.CancelFunc) {
+	serverAddress := viper.GetString("server-address")
+	appPassword := viper.GetString("app-password")
+	if appPassword == "" {
+		errorHandler(fmt.Errorf("app-password cannot be: %s", appPassword))
+	}
+	// Create a gRPC connection to the application
+	connection, err := grpc.Dial(serverAddress, grpc.WithInsecure())
+	errorHandler(err)
+	client = protos.NewAppClient(connection)
+	// Obtain a token
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	response, err := client.Authenticate(ctx, &protos.AuthenticateRequest{Password: appPassword})
+	errorHandler(err)
+	// Attach the token to subsequent requests
+	ctx = metadata.AppendToOutgoingContext(ctx, "token", response.Token)
+	return
+}
+
+func createImager(imageFile string, textBuilder text.TextBuilder, signCount uint) (imager imaging.Imager, err error) {
 	// Read in status image
 	var statusImage image.Image
 	statusImage, err = readImage(imageFile)
 	if err != nil {
 		return
 	}
-	// Create a text builder
-	textBuilder := text.NewTextBuilder(width, height, font)
 	// Create the imager
 	imager = imaging.NewImager(textBuilder, statusImage, signCount)
 	return
 }
 
+// Create the modes that can be displayed whilst idle
+func createModes(imager imaging.Imager, config config) (modes mode.Registry, err error) {
+	modes = mode.NewRegistry()
+	// The clock is always available
+	err = modes.Register("clock", mode.NewClock(imager))
+	if err != nil {
+		return
+	}
+	// Other modes are only available if configured
+	if !config.countdownTo.IsZero() {
+		err = modes.Register("countdown", mode.NewCountdown(imager, config.countdownLabel, config.countdownTo))
+		if err != nil {
+			return
+		}
+	}
+	if config.idleText != "" {
+		err = modes.Register("text", mode.NewText(imager, config.idleText))
+	}
+	return
+}
+
 // Load font from disk
 func readFont(filename string, size float64) (face font.Face, err error) {
 	var filePath string
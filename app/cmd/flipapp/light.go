@@ -0,0 +1,82 @@
+// Copyright © 2019 Sam Briggs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package flipapp
+
+import (
+	"fmt"
+
+	"github.com/briggySmalls/flipdot/app/internal/protos"
+	"github.com/spf13/cobra"
+)
+
+// lightCmd represents the light command
+var lightCmd = &cobra.Command{
+	Use:   "light",
+	Short: "Control the backlight of a running flipdot application",
+}
+
+// lightOnCmd represents the light on command
+var lightOnCmd = &cobra.Command{
+	Use:   "on",
+	Short: "Turn the backlight on",
+	Run: func(cmd *cobra.Command, args []string) {
+		setLight(protos.LightRequest_ON)
+	},
+}
+
+// lightOffCmd represents the light off command
+var lightOffCmd = &cobra.Command{
+	Use:   "off",
+	Short: "Turn the backlight off",
+	Run: func(cmd *cobra.Command, args []string) {
+		setLight(protos.LightRequest_OFF)
+	},
+}
+
+// lightStatusCmd represents the light status command
+var lightStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Report whether the backlight is on",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, ctx, cancel := createAppClient()
+		defer cancel()
+		response, err := client.GetLight(ctx, &protos.GetLightRequest{})
+		errorHandler(err)
+		if response.On {
+			fmt.Println("on")
+		} else {
+			fmt.Println("off")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(lightCmd)
+	lightCmd.AddCommand(lightOnCmd, lightOffCmd, lightStatusCmd)
+}
+
+// Request the application sets the light to the specified status
+func setLight(status protos.LightRequest_Status) {
+	client, ctx, cancel := createAppClient()
+	defer cancel()
+	_, err := client.Light(ctx, &protos.LightRequest{Status: status})
+	errorHandler(err)
+}
@@ -2,18 +2,19 @@ package flipapp
 
 import (
 	"context"
-	"image"
-	"image/color"
 	"io/ioutil"
 	"log"
 	"sync"
 	"time"
 
+	"github.com/briggySmalls/flipdot/app/internal/imaging"
 	"github.com/briggySmalls/flipdot/app/internal/protos"
 	"github.com/gizak/termui/v3"
 	"github.com/gizak/termui/v3/widgets"
 	rpio "github.com/stianeikeland/go-rpio/v4"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // Mock output pin
@@ -108,6 +109,11 @@ func (m *mockUI) GetInfo(ctx context.Context, in *protos.GetInfoRequest, opts ..
 	// Return the baked-in mocked signs
 	return &protos.GetInfoResponse{
 		Signs: m.signConfig,
+		Capabilities: []protos.GetInfoResponse_Capability{
+			protos.GetInfoResponse_LIGHT,
+			protos.GetInfoResponse_TEST,
+		},
+		Version: "mock",
 	}, nil
 }
 
@@ -116,8 +122,11 @@ func (m *mockUI) Draw(ctx context.Context, in *protos.DrawRequest, opts ...grpc.
 	// Find the sign
 	for i, sign := range m.signConfig {
 		if sign.Name == in.Sign {
-			// Draw the image
-			img := unslice(*in.Image, sign.Width, sign.Height)
+			// Draw the image, however it was encoded
+			img, err := imaging.Unslice(in.Image, uint(sign.Width), uint(sign.Height))
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "Invalid image: %s", err)
+			}
 			// Draw the image to the terminal
 			m.uiSigns[i].Image = img
 			// Render the update
@@ -127,6 +136,11 @@ func (m *mockUI) Draw(ctx context.Context, in *protos.DrawRequest, opts ...grpc.
 	return &protos.DrawResponse{}, nil
 }
 
+// Mock the DrawStream function, which isn't supported so images are drawn one at a time
+func (m *mockUI) DrawStream(ctx context.Context, opts ...grpc.CallOption) (protos.Driver_DrawStreamClient, error) {
+	return nil, status.Error(codes.Unimplemented, "Streamed drawing not supported")
+}
+
 func (m *mockUI) Test(ctx context.Context, in *protos.TestRequest, opts ...grpc.CallOption) (*protos.TestResponse, error) {
 	// Return and do nothing
 	return &protos.TestResponse{}, nil
@@ -137,25 +151,6 @@ func (m *mockUI) Light(ctx context.Context, in *protos.LightRequest, opts ...grp
 	return &protos.LightResponse{}, nil
 }
 
-func unslice(imgIn protos.Image, width, height uint32) image.Image {
-	// Create an image to hold the unpacked pixels
-	imgOut := image.NewGray(image.Rect(0, 0, int(width), int(height)))
-	// Iterate through the pixels
-	for i, pixel := range imgIn.Data {
-		row := i / int(width)
-		col := i % int(width)
-		var c color.Gray
-		if pixel {
-			c = color.Gray{255}
-		} else {
-			c = color.Gray{0}
-		}
-		imgOut.SetGray(col, row, c)
-	}
-	// Return the new image
-	return imgOut
-}
-
 func (m *mockUI) ProcessEvents() {
 	// Get the poll events channel
 	uiEvents := termui.PollEvents()
@@ -21,17 +21,27 @@
 package flipapp
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/briggySmalls/flipdot/app/internal"
 	"github.com/briggySmalls/flipdot/app/internal/button"
 	"github.com/briggySmalls/flipdot/app/internal/client"
+	"github.com/briggySmalls/flipdot/app/internal/events"
+	"github.com/briggySmalls/flipdot/app/internal/hanover"
+	"github.com/briggySmalls/flipdot/app/internal/layout"
 	"github.com/briggySmalls/flipdot/app/internal/protos"
+	"github.com/briggySmalls/flipdot/app/internal/queue"
+	"github.com/briggySmalls/flipdot/app/internal/schedule"
+	"github.com/briggySmalls/flipdot/app/internal/text"
+	"github.com/golang/protobuf/ptypes"
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -39,6 +49,8 @@ import (
 
 const (
 	buttonDebounceDuration = time.Millisecond * 50
+	eventBufferSize        = 20
+	shutdownTimeout        = time.Second * 10
 )
 
 var cfgFile string
@@ -53,8 +65,29 @@ type config struct {
 	appPassword       string
 	buttonPin         uint8
 	ledPin            uint8
+	serialPort        string
+	serialBaud        int
+	signPin           uint8
+	lightPin          uint8
+	signs             []hanover.Sign
+	driverAddress     string
+	backend           string
+	pngDir            string
+	pngScale          int
 	statusImage       string
 	tokenExpiry       time.Duration
+	queueFile         string
+	scheduleFile      string
+	lightPeriod       *schedule.Period
+	quietPeriod       *schedule.Period
+	mode              string
+	countdownLabel    string
+	countdownTo       time.Time
+	idleText          string
+	playlist          []*protos.Playlist_Entry
+	layout            []layout.Placement
+	transforms        map[string]client.Transform
+	fitImages         bool
 }
 
 // rootCmd represents the base command when called without any subcommands
@@ -89,6 +122,17 @@ func init() {
 	persistentFlags.String("app-password", "", "password required for authorisation")
 	persistentFlags.String("status-image", "", "image to indicate new message status")
 	persistentFlags.DurationP("token-expiry", "t", time.Hour, "duration after which a login token expires")
+	persistentFlags.String("queue-file", "flipapp.db", "file used to persist queued messages")
+	persistentFlags.String("schedule-file", "schedule.db", "file used to persist scheduled messages")
+	persistentFlags.String("light-on", "", "time of day (HH:MM) to turn the light on")
+	persistentFlags.String("light-off", "", "time of day (HH:MM) to turn the light off")
+	persistentFlags.String("quiet-start", "", "time of day (HH:MM) to stop drawing and hold messages")
+	persistentFlags.String("quiet-end", "", "time of day (HH:MM) to resume drawing and release messages")
+	persistentFlags.String("mode", "clock", "name of the mode to display whilst idle")
+	persistentFlags.String("countdown-label", "", "name of the event shown by the countdown mode")
+	persistentFlags.String("countdown-to", "", "time (RFC3339) the countdown mode counts down to")
+	persistentFlags.String("idle-text", "", "text shown by the text mode")
+	persistentFlags.Bool("fit-images", false, "crop or pad images of the wrong size, rather than rejecting them")
 
 	// Add all flags to config
 	viper.BindPFlags(persistentFlags)
@@ -132,6 +176,8 @@ func getCommonConfig() config {
 	appPassword := viper.GetString("app-password")
 	statusImage := viper.GetString("status-image")
 	tokenExpiry := viper.GetDuration("token-expiry")
+	queueFile := viper.GetString("queue-file")
+	scheduleFile := viper.GetString("schedule-file")
 
 	if serverAddress == "" {
 		errorHandler(fmt.Errorf("server-address cannot be: %s", serverAddress))
@@ -154,6 +200,30 @@ func getCommonConfig() config {
 	if tokenExpiry == 0 {
 		errorHandler(fmt.Errorf("token-expiry cannot be: %d", tokenExpiry))
 	}
+	if queueFile == "" {
+		errorHandler(fmt.Errorf("queue-file cannot be: %s", queueFile))
+	}
+	if scheduleFile == "" {
+		errorHandler(fmt.Errorf("schedule-file cannot be: %s", scheduleFile))
+	}
+	lightPeriod := getPeriod("light-on", "light-off")
+	quietPeriod := getPeriod("quiet-start", "quiet-end")
+	mode := viper.GetString("mode")
+	if mode == "" {
+		errorHandler(fmt.Errorf("mode cannot be: %s", mode))
+	}
+	countdownLabel := viper.GetString("countdown-label")
+	var countdownTo time.Time
+	if value := viper.GetString("countdown-to"); value != "" {
+		var err error
+		countdownTo, err = time.Parse(time.RFC3339, value)
+		errorHandler(err)
+	}
+	idleText := viper.GetString("idle-text")
+	playlist := getPlaylist()
+	placements := getLayout()
+	transforms := getTransforms()
+	fitImages := viper.GetBool("fit-images")
 
 	fmt.Println("")
 	fmt.Println("Starting server with the following configuration:")
@@ -163,6 +233,27 @@ func getCommonConfig() config {
 	fmt.Printf("frame-duration: %d\n", frameDuration)
 	fmt.Printf("status-image: %s\n", statusImage)
 	fmt.Printf("token-expiry: %d\n", tokenExpiry)
+	fmt.Printf("queue-file: %s\n", queueFile)
+	fmt.Printf("schedule-file: %s\n", scheduleFile)
+	fmt.Printf("light-on: %s\n", viper.GetString("light-on"))
+	fmt.Printf("light-off: %s\n", viper.GetString("light-off"))
+	fmt.Printf("quiet-start: %s\n", viper.GetString("quiet-start"))
+	fmt.Printf("quiet-end: %s\n", viper.GetString("quiet-end"))
+	fmt.Printf("mode: %s\n", mode)
+	fmt.Printf("countdown-label: %s\n", countdownLabel)
+	fmt.Printf("countdown-to: %s\n", viper.GetString("countdown-to"))
+	fmt.Printf("idle-text: %s\n", idleText)
+	for _, entry := range playlist {
+		duration, _ := ptypes.Duration(entry.Duration)
+		fmt.Printf("playlist: %s for %s\n", entry.Mode, duration)
+	}
+	for _, placement := range placements {
+		fmt.Printf("layout: %+v\n", placement)
+	}
+	for sign, transform := range transforms {
+		fmt.Printf("transform: %s %+v\n", sign, transform)
+	}
+	fmt.Printf("fit-images: %t\n", fitImages)
 
 	return config{
 		serverAddress:     serverAddress,
@@ -173,41 +264,226 @@ func getCommonConfig() config {
 		appPassword:       appPassword,
 		statusImage:       statusImage,
 		tokenExpiry:       tokenExpiry,
+		queueFile:         queueFile,
+		scheduleFile:      scheduleFile,
+		lightPeriod:       lightPeriod,
+		quietPeriod:       quietPeriod,
+		mode:              mode,
+		countdownLabel:    countdownLabel,
+		countdownTo:       countdownTo,
+		idleText:          idleText,
+		playlist:          playlist,
+		layout:            placements,
+		transforms:        transforms,
+		fitImages:         fitImages,
+	}
+}
+
+// Get an optional daily period from a pair of config times
+func getPeriod(startKey, endKey string) *schedule.Period {
+	start := viper.GetString(startKey)
+	end := viper.GetString(endKey)
+	if start == "" && end == "" {
+		// Period not configured
+		return nil
+	}
+	if start == "" || end == "" {
+		errorHandler(fmt.Errorf("%s and %s must be supplied together", startKey, endKey))
+	}
+	period, err := schedule.ParsePeriod(start, end)
+	errorHandler(err)
+	return period
+}
+
+// Get the (optional) playlist of modes to rotate through whilst idle
+func getPlaylist() (playlist []*protos.Playlist_Entry) {
+	var entries []struct {
+		Mode     string
+		Duration time.Duration
+	}
+	err := viper.UnmarshalKey("playlist", &entries)
+	errorHandler(err)
+	for _, entry := range entries {
+		if entry.Mode == "" || entry.Duration <= 0 {
+			errorHandler(fmt.Errorf("playlist entries need a mode and positive duration"))
+		}
+		playlist = append(playlist, &protos.Playlist_Entry{
+			Mode:     entry.Mode,
+			Duration: ptypes.DurationProto(entry.Duration),
+		})
+	}
+	return
+}
+
+// Get the (optional) placement of signs on a canvas spanning them
+func getLayout() (placements []layout.Placement) {
+	var entries []struct {
+		Sign        string
+		X           uint `mapstructure:"x-offset"`
+		Y           uint `mapstructure:"y-offset"`
+		Orientation string
+	}
+	err := viper.UnmarshalKey("layout", &entries)
+	errorHandler(err)
+	for _, entry := range entries {
+		if entry.Sign == "" {
+			errorHandler(fmt.Errorf("layout entries need a sign"))
+		}
+		orientation, err := layout.ParseOrientation(entry.Orientation)
+		errorHandler(err)
+		placements = append(placements, layout.Placement{
+			Sign:        entry.Sign,
+			X:           entry.X,
+			Y:           entry.Y,
+			Orientation: orientation,
+		})
+	}
+	return
+}
+
+// Get the (optional) changes made to images to suit how each sign is mounted
+func getTransforms() (transforms map[string]client.Transform) {
+	var entries []struct {
+		Sign             string
+		Rotate180        bool `mapstructure:"rotate-180"`
+		MirrorHorizontal bool `mapstructure:"mirror-horizontal"`
+		MirrorVertical   bool `mapstructure:"mirror-vertical"`
+		Invert           bool
 	}
+	err := viper.UnmarshalKey("transforms", &entries)
+	errorHandler(err)
+	transforms = make(map[string]client.Transform)
+	for _, entry := range entries {
+		if entry.Sign == "" {
+			errorHandler(fmt.Errorf("transforms need a sign"))
+		}
+		if _, ok := transforms[entry.Sign]; ok {
+			errorHandler(fmt.Errorf("sign %s transformed more than once", entry.Sign))
+		}
+		transforms[entry.Sign] = client.Transform{
+			Rotate180:        entry.Rotate180,
+			MirrorHorizontal: entry.MirrorHorizontal,
+			MirrorVertical:   entry.MirrorVertical,
+			Invert:           entry.Invert,
+		}
+	}
+	return
+}
+
+// Get the configuration of signs attached directly to a serial port
+func getSigns() (signs []hanover.Sign) {
+	err := viper.UnmarshalKey("signs", &signs)
+	errorHandler(err)
+	if len(signs) == 0 {
+		errorHandler(fmt.Errorf("signs must be configured"))
+	}
+	for _, sign := range signs {
+		if sign.Name == "" || sign.Width == 0 || sign.Height == 0 {
+			errorHandler(fmt.Errorf("signs need a name, width and height"))
+		}
+	}
+	return
 }
 
 // Create components and run application
 func runApp(clnt protos.DriverClient, bm button.ButtonManager, config config) {
-	// Create a flipdot controller
+	// Stop the client and application, interrupting any drawing, when asked to shut down
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Create a hub for sharing events between components
+	hub := events.NewHub(eventBufferSize)
+
+	// Create a flipdot controller (waiting for the driver, if it isn't up yet)
 	flippy, err := client.NewFlipdot(
+		ctx,
 		clnt,
-		time.Duration(config.frameDurationSecs)*time.Second)
+		time.Duration(config.frameDurationSecs)*time.Second,
+		hub,
+		config.layout,
+		config.transforms,
+		config.fitImages)
 	errorHandler(err)
 
 	// Get font
 	font, err := readFont(config.fontFile, config.fontSize)
-	// Create imager
-	width, height := flippy.Size()
-	imager, err := createImager(config.statusImage, font, width, height, uint(len(flippy.Signs())))
+	// Create imager, which draws on the canvas if the signs span one
+	var textBuilder text.TextBuilder
+	signCount := uint(1)
+	if canvas := flippy.Layout(); canvas != nil {
+		width, height := canvas.Size()
+		textBuilder = text.NewCanvasTextBuilder(text.Size{Width: width, Height: height}, font)
+	} else {
+		var sizes []text.Size
+		for _, sign := range flippy.Signs() {
+			sizes = append(sizes, text.Size{Width: uint(sign.Width), Height: uint(sign.Height)})
+		}
+		textBuilder = text.NewTextBuilder(sizes, font)
+		signCount = uint(len(sizes))
+	}
+	imager, err := createImager(config.statusImage, textBuilder, signCount)
+	errorHandler(err)
+
+	// Open the message queue
+	messageQueue, err := queue.NewMessageQueue(config.queueFile)
 	errorHandler(err)
+	defer messageQueue.Close()
+
+	// Open the message scheduler
+	scheduler, err := schedule.NewScheduler(config.scheduleFile)
+	errorHandler(err)
+	defer scheduler.Close()
+
+	// Register the modes that can be displayed whilst idle
+	modes, err := createModes(imager, config)
+	errorHandler(err)
+	if _, err := modes.Get(config.mode); err != nil {
+		errorHandler(fmt.Errorf("mode %s not available (choose from %v)", config.mode, modes.Names()))
+	}
+	for _, entry := range config.playlist {
+		if _, err := modes.Get(entry.Mode); err != nil {
+			errorHandler(fmt.Errorf("playlist mode %s not available (choose from %v)", entry.Mode, modes.Names()))
+		}
+	}
 
 	// Create and start application
-	app := internal.NewApplication(flippy, bm, imager)
-	go app.Run(30 * time.Second)
+	app, err := internal.NewApplication(flippy, bm, imager, messageQueue, scheduler, hub, config.lightPeriod, config.quietPeriod, modes, config.mode, config.playlist)
+	errorHandler(err)
+	go app.Run(ctx, 30*time.Second)
 	// Create a flipapps server
-	server := createServer(config.appSecret, config.appPassword, config.tokenExpiry, app.GetMessagesChannel(), flippy.Signs())
+	server := createServer(ctx, config.appSecret, config.appPassword, config.tokenExpiry, app.GetMessagesChannel(), app, app, app, flippy, flippy.Signs())
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+		// Let a second signal kill us, if shutting down gets stuck
+		signal.Stop(signals)
+		log.Println("Shutting down...")
+		cancel()
+		stopped := make(chan struct{})
+		go func() {
+			server.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(shutdownTimeout):
+			log.Println("Timed out waiting for requests to finish, stopping anyway")
+			server.Stop()
+		}
+	}()
 	// Run server
 	// Create a listener on TCP port
-	lis, err := net.Listen("tcp", fmt.Sprintf(config.serverAddress))
+	lis, err := net.Listen("tcp", config.serverAddress)
 	errorHandler(err)
 	if err := server.Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %s", err)
 	}
 }
 
-// Generic error handler
+// Generic error handler, for errors the command cannot recover from
 func errorHandler(err error) {
 	if err != nil {
-		panic(err)
+		log.Fatalf("Error: %s", err)
 	}
 }
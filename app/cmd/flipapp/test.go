@@ -0,0 +1,63 @@
+// Copyright © 2019 Sam Briggs
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package flipapp
+
+import (
+	"github.com/briggySmalls/flipdot/app/internal/protos"
+	"github.com/spf13/cobra"
+)
+
+// testCmd represents the test command
+var testCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Control the test sequence of a running flipdot application",
+}
+
+// testStartCmd represents the test start command
+var testStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start the driver's test sequence",
+	Run: func(cmd *cobra.Command, args []string) {
+		runTestAction(protos.TestRequest_START)
+	},
+}
+
+// testStopCmd represents the test stop command
+var testStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the driver's test sequence",
+	Run: func(cmd *cobra.Command, args []string) {
+		runTestAction(protos.TestRequest_STOP)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(testCmd)
+	testCmd.AddCommand(testStartCmd, testStopCmd)
+}
+
+// Request the application starts or stops the test sequence
+func runTestAction(action protos.TestRequest_Action) {
+	client, ctx, cancel := createAppClient()
+	defer cancel()
+	_, err := client.Test(ctx, &protos.TestRequest{Action: action})
+	errorHandler(err)
+}
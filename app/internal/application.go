@@ -1,58 +1,263 @@
 package internal
 
 import (
+	"context"
 	fmt "fmt"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/briggySmalls/flipdot/app/internal/button"
 	"github.com/briggySmalls/flipdot/app/internal/client"
+	"github.com/briggySmalls/flipdot/app/internal/events"
 	"github.com/briggySmalls/flipdot/app/internal/imaging"
+	"github.com/briggySmalls/flipdot/app/internal/mode"
 	"github.com/briggySmalls/flipdot/app/internal/protos"
-	"github.com/briggySmalls/flipdot/app/internal/shared"
+	"github.com/briggySmalls/flipdot/app/internal/queue"
+	"github.com/briggySmalls/flipdot/app/internal/schedule"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const (
 	messageInSize = 20
 )
 
+// Error returned for requests made once the application loop has stopped
+var ErrStopped = status.Error(codes.Unavailable, "application stopped")
+
 type application struct {
 	flipdot       client.Flipdot
 	buttonManager button.ButtonManager
 	imager        imaging.Imager
+	// Persistent queue of messages waiting to be displayed
+	queue queue.MessageQueue
+	// Persistent record of messages to release into the queue later
+	scheduler schedule.Scheduler
 	// Externally-visible channel for adding messages to the application
 	messagesIn chan protos.MessageRequest
+	// Internal channel for running actions on the queue within the application loop
+	actions chan func()
+	// Closed once the application loop has stopped, so no more actions will run
+	stopped chan struct{}
+	// Hub for notifying subscribers of application events
+	events events.Hub
+	// Period of each day during which the light should be on (optional)
+	lightPeriod *schedule.Period
+	// Period of each day during which the signs should be left alone (optional)
+	quietPeriod *schedule.Period
+	// Whether the light schedule has been applied, and what it set the light to
+	isLightScheduled bool
+	isLightOn        bool
+	// Modes available to display whilst idle
+	modes mode.Registry
+	// Name of the mode currently displayed whilst idle, and the mode itself
+	modeName string
+	mode     mode.Mode
+	// Rotation of modes displayed whilst idle (nil if not rotating)
+	playlist mode.Playlist
+	// Context the application loop runs within, cancelled on shutdown
+	ctx context.Context
+	// Cancels the message being displayed (nil if no message is being displayed)
+	cancelMessage context.CancelFunc
+	cancelMux     sync.Mutex
 }
 
 type Application interface {
 	GetMessagesChannel() chan protos.MessageRequest
-	Run(tickPeriod time.Duration)
+	ListMessages(ctx context.Context) ([]*protos.QueuedMessage, error)
+	DeleteMessage(ctx context.Context, id uint64) error
+	MoveMessage(ctx context.Context, id uint64, position int) error
+	ClearMessages(ctx context.Context) error
+	ListFailedMessages(ctx context.Context) ([]*protos.FailedMessage, error)
+	RetryFailedMessage(ctx context.Context, id uint64) error
+	DeleteFailedMessage(ctx context.Context, id uint64) error
+	ScheduleMessage(ctx context.Context, request protos.ScheduleRequest) (*protos.ScheduledMessage, error)
+	ListSchedules(ctx context.Context) ([]*protos.ScheduledMessage, error)
+	CancelSchedule(ctx context.Context, id uint64) error
+	SetMode(ctx context.Context, name string) error
+	GetMode(ctx context.Context) (name string, available []string, err error)
+	SetPlaylist(ctx context.Context, entries []*protos.Playlist_Entry) error
+	GetPlaylist(ctx context.Context) ([]*protos.Playlist_Entry, error)
+	SubscribeEvents() (<-chan *protos.Event, func())
+	Run(ctx context.Context, tickPeriod time.Duration)
 }
 
 // Creates and initialises a new Application
-func NewApplication(flipdot client.Flipdot, buttonManager button.ButtonManager, imager imaging.Imager) Application {
+func NewApplication(flipdot client.Flipdot, buttonManager button.ButtonManager, imager imaging.Imager, queue queue.MessageQueue, scheduler schedule.Scheduler, events events.Hub, lightPeriod, quietPeriod *schedule.Period, modes mode.Registry, modeName string, playlist []*protos.Playlist_Entry) (Application, error) {
 	app := application{
 		flipdot:       flipdot,
 		buttonManager: buttonManager,
 		imager:        imager,
+		queue:         queue,
+		scheduler:     scheduler,
 		messagesIn:    make(chan protos.MessageRequest, messageInSize),
+		actions:       make(chan func()),
+		stopped:       make(chan struct{}),
+		events:        events,
+		lightPeriod:   lightPeriod,
+		quietPeriod:   quietPeriod,
+		modes:         modes,
+		ctx:           context.Background(),
+	}
+	// Start off in the requested mode, or rotating through the playlist
+	var err error
+	if len(playlist) > 0 {
+		err = app.setPlaylist(playlist, time.Now())
+	} else {
+		err = app.setMode(modeName)
+	}
+	if err != nil {
+		return nil, err
 	}
-	return &app
+	return &app, nil
 }
 
 func (a *application) GetMessagesChannel() chan protos.MessageRequest {
 	return a.messagesIn
 }
 
-// Blocking call that runs forever, polling for button presses, messages, and ticks
-func (a *application) Run(tickPeriod time.Duration) {
+// Get the messages waiting to be displayed
+func (a *application) ListMessages(ctx context.Context) (messages []*protos.QueuedMessage, err error) {
+	err = a.do(ctx, func() error {
+		messages = a.queue.List()
+		return nil
+	})
+	return
+}
+
+// Remove a message from the queue
+func (a *application) DeleteMessage(ctx context.Context, id uint64) error {
+	return a.do(ctx, func() error {
+		return a.queue.Remove(id)
+	})
+}
+
+// Change the position of a message in the queue
+func (a *application) MoveMessage(ctx context.Context, id uint64, position int) error {
+	return a.do(ctx, func() error {
+		return a.queue.Move(id, position)
+	})
+}
+
+// Remove all messages from the queue
+func (a *application) ClearMessages(ctx context.Context) error {
+	return a.do(ctx, func() error {
+		return a.queue.Clear()
+	})
+}
+
+// Get the messages that could not be displayed
+func (a *application) ListFailedMessages(ctx context.Context) (messages []*protos.FailedMessage, err error) {
+	err = a.do(ctx, func() error {
+		messages = a.queue.Failed()
+		return nil
+	})
+	return
+}
+
+// Return a message that could not be displayed to the queue
+func (a *application) RetryFailedMessage(ctx context.Context, id uint64) error {
+	return a.do(ctx, func() error {
+		queued, err := a.queue.Retry(id)
+		if err != nil {
+			return err
+		}
+		a.events.Publish(&protos.Event{Payload: &protos.Event_MessageQueued{MessageQueued: queued}})
+		return nil
+	})
+}
+
+// Forget a message that could not be displayed
+func (a *application) DeleteFailedMessage(ctx context.Context, id uint64) error {
+	return a.do(ctx, func() error {
+		return a.queue.Discard(id)
+	})
+}
+
+// Add a message to be released into the queue later
+func (a *application) ScheduleMessage(ctx context.Context, request protos.ScheduleRequest) (scheduled *protos.ScheduledMessage, err error) {
+	err = a.do(ctx, func() (err error) {
+		scheduled, err = a.scheduler.Add(request)
+		return
+	})
+	return
+}
+
+// Get the messages waiting to be released into the queue
+func (a *application) ListSchedules(ctx context.Context) (schedules []*protos.ScheduledMessage, err error) {
+	err = a.do(ctx, func() error {
+		schedules = a.scheduler.List()
+		return nil
+	})
+	return
+}
+
+// Stop a message from being released into the queue
+func (a *application) CancelSchedule(ctx context.Context, id uint64) error {
+	return a.do(ctx, func() error {
+		return a.scheduler.Cancel(id)
+	})
+}
+
+// Change what is displayed whilst idle (stopping any rotation)
+func (a *application) SetMode(ctx context.Context, name string) error {
+	return a.do(ctx, func() error {
+		err := a.setMode(name)
+		if err == nil {
+			a.playlist = nil
+		}
+		return err
+	})
+}
+
+// Get the name of the mode displayed whilst idle, and the names of those available
+func (a *application) GetMode(ctx context.Context) (name string, available []string, err error) {
+	err = a.do(ctx, func() error {
+		name = a.modeName
+		return nil
+	})
+	available = a.modes.Names()
+	return
+}
+
+// Rotate through a series of modes whilst idle (stopping any rotation if empty)
+func (a *application) SetPlaylist(ctx context.Context, entries []*protos.Playlist_Entry) error {
+	return a.do(ctx, func() error {
+		if len(entries) == 0 {
+			a.playlist = nil
+			return nil
+		}
+		return a.setPlaylist(entries, time.Now())
+	})
+}
+
+// Get the series of modes rotated through whilst idle
+func (a *application) GetPlaylist(ctx context.Context) (entries []*protos.Playlist_Entry, err error) {
+	err = a.do(ctx, func() error {
+		if a.playlist != nil {
+			entries = a.playlist.Entries()
+		}
+		return nil
+	})
+	return
+}
+
+// Register to receive application events, until unsubscribed
+func (a *application) SubscribeEvents() (<-chan *protos.Event, func()) {
+	return a.events.Subscribe()
+}
+
+// Blocking call that runs until cancelled, polling for button presses, messages, and ticks
+func (a *application) Run(ctx context.Context, tickPeriod time.Duration) {
+	a.ctx = ctx
+	defer close(a.stopped)
 	// Create a ticker
 	log.Println("Starting application loop...")
-	pause := false
+	// Hold off drawing anything if we start during quiet hours
+	pause := a.isQuiet(time.Now())
 	ticker := time.NewTicker(tickPeriod)
 	defer ticker.Stop()
-	// Create intermediate message queue
-	pendingMessages := make([]protos.MessageRequest, 0)
 	// Get queue for button presses
 	buttonPressed := a.buttonManager.GetChannel()
 	// get the location
@@ -60,12 +265,49 @@ func (a *application) Run(tickPeriod time.Duration) {
 	if err != nil {
 		return
 	}
-	// Draw first clock
-	a.drawTime(time.Now().In(location), false)
+	// Set the light as the schedule demands
+	a.scheduleLight(time.Now())
+	if pause {
+		log.Println("Starting during quiet hours")
+	} else {
+		// Activate button if messages survived a restart
+		if a.queue.Len() > 0 {
+			log.Printf("Restored %d queued messages", a.queue.Len())
+			a.buttonManager.SetState(button.Active)
+		}
+		// Draw first clock
+		a.drawMode(time.Now().In(location), a.queue.Len() > 0)
+	}
+	// Watch for urgent messages, which interrupt the message being displayed
+	messagesIn := a.watchMessages(ctx)
+	// Wake when the current playlist entry ends, rather than waiting for a tick
+	var switchTimer *time.Timer
+	defer func() {
+		if switchTimer != nil {
+			switchTimer.Stop()
+		}
+	}()
 	// Run forever
 	for {
+		var switched <-chan time.Time
+		if switchTimer != nil {
+			switchTimer.Stop()
+		}
+		if a.playlist != nil {
+			switchTimer = time.NewTimer(time.Until(a.playlist.Next()))
+			switched = switchTimer.C
+		}
 		select {
-		case message, ok := <-a.messagesIn:
+		case <-ctx.Done():
+			log.Println("Stopping application loop")
+			return
+		// Move on to the next entry in the playlist (even when paused, so we don't wake repeatedly)
+		case t := <-switched:
+			a.rotateMode(t)
+			if !pause {
+				a.drawMode(t.In(location), a.queue.Len() > 0)
+			}
+		case message, ok := <-messagesIn:
 			if !ok {
 				// There will be no more messages to handle
 				// TODO: check if there are any pending message that we should wait for
@@ -73,72 +315,381 @@ func (a *application) Run(tickPeriod time.Duration) {
 			}
 			// Externally queued message is available
 			log.Println("Message received")
-			// Pass to internal buffer
-			pendingMessages = append(pendingMessages, message)
-			// We have at least one message, so activate button
-			a.buttonManager.SetState(button.Active)
-			// Update time with message status
-			a.drawTime(time.Now().In(location), true)
+			a.enqueue(message, location, pause)
+		// Handle external request to act on the queue
+		case action := <-a.actions:
+			queueLength := a.queue.Len()
+			modeName := a.modeName
+			action()
+			if a.queue.Len() != queueLength {
+				a.publishQueueLength()
+			}
+			// Show the new mode straight away, if it changed
+			if !pause && a.modeName != modeName {
+				log.Printf("Switched to %s mode", a.modeName)
+				a.drawMode(time.Now().In(location), a.queue.Len() > 0)
+			}
+			// Only update the button and clock if the queue was emptied or refilled
+			if !pause && (queueLength == 0) != (a.queue.Len() == 0) {
+				a.updateStatus(location)
+			}
 		// Handle user signal to display message
 		case <-buttonPressed:
 			log.Println("Show message request")
+			a.events.Publish(&protos.Event{Payload: &protos.Event_ButtonPressed{ButtonPressed: &protos.ButtonPress{}}})
+			if pause {
+				// Messages are held until the quiet period ends
+				break
+			}
+			// Don't show messages that have expired since the last tick
+			if a.expireMessages(time.Now()) && a.queue.Len() == 0 {
+				a.updateStatus(location)
+			}
 			// Check if there are pending messages
-			if len(pendingMessages) > 0 {
-				log.Println("Displaying message")
-				// Disable button whilst we show a message
-				a.buttonManager.SetState(button.Inactive)
-				// Pop message
-				message := pendingMessages[0]
-				pendingMessages = pendingMessages[1:]
-				// Display message
-				a.handleMessage(message)
-				// Reenable button if there are more messages
-				if len(pendingMessages) > 0 {
-					a.buttonManager.SetState(button.Active)
-				}
+			if message := a.queue.Peek(); message != nil {
+				a.displayMessage(message)
 			}
 		// Otherwise display the time
 		case t := <-ticker.C:
-			// Only display the time if we've not paused the clock
-			if !pause {
+			// Switch the light on or off, if it is time to
+			a.scheduleLight(t)
+			// Check if the quiet period has started or ended
+			if isQuiet := a.isQuiet(t); isQuiet != pause {
+				pause = isQuiet
+				if pause {
+					log.Println("Quiet period started")
+					a.buttonManager.SetState(button.Inactive)
+				} else {
+					log.Println("Quiet period ended")
+					a.updateStatus(location)
+				}
+			}
+			// Drop any messages that have expired
+			isExpired := a.expireMessages(t)
+			// Release any scheduled messages that are due (this redraws the clock)
+			messages, err := a.scheduler.Due(t)
+			if err != nil {
+				a.reportError("Failed to release scheduled messages", err)
+			}
+			for _, message := range messages {
+				log.Println("Scheduled message released")
+				a.enqueue(message, location, pause)
+			}
+			if !pause && isExpired && a.queue.Len() == 0 {
+				// Nothing valid is left, so deactivate the button and clear the status
+				a.updateStatus(location)
+			} else if !pause && len(messages) == 0 {
+				// Only redraw the mode if we've not paused the clock
 				log.Println("Tick event")
-				// Print the time (centred)
-				a.drawTime(t, len(pendingMessages) > 0)
+				a.rotateMode(t)
+				a.drawMode(t, a.queue.Len() > 0)
+				a.events.Publish(&protos.Event{Payload: &protos.Event_ClockTick{ClockTick: &protos.ClockTick{}}})
 			}
 		}
 	}
 }
 
-// Helper function to draw the time on the signs
-func (a *application) drawTime(time time.Time, isMessageAvailable bool) {
-	// Print the time (centred)
-	images, err := a.imager.Clock(time, isMessageAvailable)
-	shared.ErrorHandler(err)
-	err = a.flipdot.Draw(images, false)
-	shared.ErrorHandler(err)
+// Run an action within the application loop, waiting until it completes
+//
+// Gives up if the caller does, or the loop stops, before the action is taken
+// up. Actions are quick, so once taken up there is no need to give up.
+func (a *application) do(ctx context.Context, action func() error) (err error) {
+	done := make(chan struct{})
+	select {
+	case a.actions <- func() {
+		err = action()
+		close(done)
+	}:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-a.stopped:
+		return ErrStopped
+	}
+	<-done
+	return
 }
 
-// Gets a message sent to the flipdot signs
-func (a *application) handleMessage(message protos.MessageRequest) {
+// Helper function to pass on received messages, interrupting the displayed message if an urgent one arrives
+//
+// Messages are held here until the loop is ready for them, so urgent messages
+// aren't kept waiting behind others whilst a message is displayed.
+func (a *application) watchMessages(ctx context.Context) <-chan protos.MessageRequest {
+	messages := make(chan protos.MessageRequest)
+	go func() {
+		defer close(messages)
+		var pending []protos.MessageRequest
+		in := a.messagesIn
+		for in != nil || len(pending) > 0 {
+			// Only offer a message to the loop if one is waiting
+			var out chan<- protos.MessageRequest
+			var next protos.MessageRequest
+			if len(pending) > 0 {
+				out = messages
+				next = pending[0]
+			}
+			select {
+			case message, ok := <-in:
+				if !ok {
+					// Pass on what we have, then stop
+					in = nil
+					break
+				}
+				if message.Priority == protos.MessageRequest_URGENT {
+					a.interruptMessage()
+				}
+				pending = append(pending, message)
+			case out <- next:
+				pending = pending[1:]
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return messages
+}
+
+// Helper function to stop drawing the message being displayed, if there is one
+func (a *application) interruptMessage() {
+	a.cancelMux.Lock()
+	defer a.cancelMux.Unlock()
+	if a.cancelMessage != nil {
+		log.Println("Interrupting message")
+		a.cancelMessage()
+	}
+}
+
+// Helper function to add a message to the queue, holding it there if paused
+func (a *application) enqueue(message protos.MessageRequest, location *time.Location, isPaused bool) {
+	// Persist to the queue
+	queued, err := a.queue.Push(message)
+	if err != nil {
+		a.reportError(fmt.Sprintf("Failed to queue message from %s", message.From), err)
+		return
+	}
+	a.events.Publish(&protos.Event{Payload: &protos.Event_MessageQueued{MessageQueued: queued}})
+	a.publishQueueLength()
+	if isPaused {
+		// Leave the signs and button alone until the quiet period ends
+		return
+	} else if message.Priority == protos.MessageRequest_URGENT {
+		// Urgent messages are shown without waiting for the button
+		a.displayMessage(queued)
+	} else {
+		// We have at least one message, so activate button and show status
+		a.updateStatus(location)
+	}
+}
+
+// Helper function to remove expired messages from the queue, indicating if any were removed
+func (a *application) expireMessages(now time.Time) bool {
+	count, err := a.queue.Expire(now)
+	if err != nil {
+		a.reportError("Failed to expire messages", err)
+	}
+	if count > 0 {
+		log.Printf("Dropped %d expired messages", count)
+		a.publishQueueLength()
+	}
+	return count > 0
+}
+
+// Helper function to display a queued message, removing it once drawn
+func (a *application) displayMessage(message *protos.QueuedMessage) {
+	log.Println("Displaying message")
+	// Disable button whilst we show a message
+	a.buttonManager.SetState(button.Inactive)
+	// Display message, allowing it to be interrupted
+	ctx, cancel := context.WithCancel(a.ctx)
+	a.cancelMux.Lock()
+	a.cancelMessage = cancel
+	a.cancelMux.Unlock()
+	drawn, err := a.handleMessage(ctx, *message.Message)
+	a.cancelMux.Lock()
+	a.cancelMessage = nil
+	a.cancelMux.Unlock()
+	cancel()
+	if err == context.Canceled {
+		// Keep the message so it can be shown in full later
+		log.Printf("Message %d interrupted after %d images", message.Id, drawn)
+	} else if err != nil {
+		a.failMessage(message, err)
+	} else {
+		a.events.Publish(&protos.Event{Payload: &protos.Event_MessageDisplayed{MessageDisplayed: message}})
+		// Only forget the message once it has been drawn
+		err = a.queue.Remove(message.Id)
+		if err != nil {
+			a.reportError(fmt.Sprintf("Failed to remove message %d", message.Id), err)
+		}
+	}
+	a.publishQueueLength()
+	// Reenable button if there are more messages
+	if a.queue.Len() > 0 {
+		a.buttonManager.SetState(button.Active)
+	}
+}
+
+// Helper function to handle a message that could not be displayed
+func (a *application) failMessage(message *protos.QueuedMessage, err error) {
+	log.Printf("Failed to display message %d: %s", message.Id, err)
+	retrying := client.IsUnreachable(err)
+	if !retrying {
+		// Trying again won't help, so set the message aside
+		moveErr := a.queue.Fail(message.Id, err.Error())
+		if moveErr != nil {
+			a.reportError(fmt.Sprintf("Failed to set aside message %d", message.Id), moveErr)
+		}
+	}
+	// Otherwise keep the message so it can be shown once the driver is back
+	a.events.Publish(&protos.Event{Payload: &protos.Event_MessageFailed{MessageFailed: &protos.MessageFailed{
+		Message:  message,
+		Error:    err.Error(),
+		Retrying: retrying,
+	}}})
+}
+
+// Helper function to log an error and notify subscribers of it
+func (a *application) reportError(context string, err error) {
+	log.Printf("%s: %s", context, err)
+	a.events.Publish(&protos.Event{Payload: &protos.Event_ApplicationError{ApplicationError: &protos.ApplicationError{
+		Error: fmt.Sprintf("%s: %s", context, err),
+	}}})
+}
+
+// Helper function to check if the specified time is within quiet hours
+func (a *application) isQuiet(t time.Time) bool {
+	return a.quietPeriod != nil && a.quietPeriod.Contains(t)
+}
+
+// Helper function to switch the light on or off, if the schedule has changed
+func (a *application) scheduleLight(t time.Time) {
+	if a.lightPeriod == nil {
+		return
+	}
+	// Only act on changes, so the light can still be overridden manually
+	isOn := a.lightPeriod.Contains(t)
+	if a.isLightScheduled && isOn == a.isLightOn {
+		return
+	}
 	var err error
+	if isOn {
+		log.Println("Turning light on")
+		err = a.flipdot.LightOn()
+	} else {
+		log.Println("Turning light off")
+		err = a.flipdot.LightOff()
+	}
+	if err == client.ErrUnsupported {
+		// There is no light to control
+		log.Println("Driver has no light, ignoring light schedule")
+		a.lightPeriod = nil
+		return
+	} else if err != nil {
+		// Try again on the next tick
+		log.Printf("Failed to set light: %s", err)
+		a.events.Publish(&protos.Event{Payload: &protos.Event_DriverError{DriverError: &protos.DriverError{Error: err.Error()}}})
+		return
+	}
+	a.isLightScheduled = true
+	a.isLightOn = isOn
+}
+
+// Helper function to update the button and clock to reflect the queue
+func (a *application) updateStatus(location *time.Location) {
+	isMessageAvailable := a.queue.Len() > 0
+	if isMessageAvailable {
+		a.buttonManager.SetState(button.Active)
+	} else {
+		a.buttonManager.SetState(button.Inactive)
+	}
+	a.drawMode(time.Now().In(location), isMessageAvailable)
+}
+
+// Helper function to switch to the mode registered with the specified name
+func (a *application) setMode(name string) error {
+	mode, err := a.modes.Get(name)
+	if err != nil {
+		return err
+	}
+	a.modeName = name
+	a.mode = mode
+	return nil
+}
+
+// Helper function to start rotating through a playlist, with its first entry
+func (a *application) setPlaylist(entries []*protos.Playlist_Entry, now time.Time) error {
+	// Check all the modes exist before we commit to anything
+	for _, entry := range entries {
+		if _, err := a.modes.Get(entry.Mode); err != nil {
+			return err
+		}
+	}
+	playlist, err := mode.NewPlaylist(entries, now)
+	if err != nil {
+		return err
+	}
+	a.playlist = playlist
+	return a.setMode(playlist.Mode(now))
+}
+
+// Helper function to move on to the next mode in the playlist, if it is time to
+func (a *application) rotateMode(now time.Time) {
+	if a.playlist == nil {
+		return
+	}
+	name := a.playlist.Mode(now)
+	if name != a.modeName {
+		log.Printf("Rotating to %s mode", name)
+		err := a.setMode(name)
+		if err != nil {
+			a.reportError(fmt.Sprintf("Failed to rotate to %s mode", name), err)
+		}
+	}
+}
+
+// Helper function to draw the current mode on the signs
+func (a *application) drawMode(time time.Time, isMessageAvailable bool) {
+	images, err := a.mode.Frame(time, isMessageAvailable)
+	if err != nil {
+		a.reportError(fmt.Sprintf("Failed to create %s mode images", a.modeName), err)
+		return
+	}
+	_, err = a.draw(a.ctx, images, false)
+	if err != nil && a.ctx.Err() == nil {
+		// The driver is unhealthy, so just wait for the next redraw
+		log.Printf("Failed to draw %s mode: %s", a.modeName, err)
+	}
+}
+
+// Gets a message sent to the flipdot signs
+func (a *application) handleMessage(ctx context.Context, message protos.MessageRequest) (drawn int, err error) {
 	switch message.Payload.(type) {
 	case *protos.MessageRequest_Images:
-		err = a.sendImages(message.GetImages().Images)
+		drawn, err = a.draw(ctx, message.GetImages().Images, true)
 	case *protos.MessageRequest_Text:
 		// Create images from message
-		images, err := a.imager.Message(message.From, message.GetText())
-		shared.ErrorHandler(err)
+		var images []*protos.Image
+		images, err = a.imager.Message(message.From, message.GetText())
+		if err != nil {
+			return
+		}
 		// Send images
-		a.sendImages(images)
+		drawn, err = a.draw(ctx, images, true)
 	default:
 		err = fmt.Errorf("Neither images or text supplied")
 	}
-	// Handle errors
-	shared.ErrorHandler(err)
+	return
 }
 
-// Helper function to send images to the signs
-func (a *application) sendImages(images []*protos.Image) (err error) {
-	err = a.flipdot.Draw(images, true)
+// Helper function to draw images, reporting any driver errors (but not cancellation)
+func (a *application) draw(ctx context.Context, images []*protos.Image, isWait bool) (drawn int, err error) {
+	drawn, err = a.flipdot.Draw(ctx, images, isWait)
+	if err != nil && ctx.Err() == nil {
+		a.events.Publish(&protos.Event{Payload: &protos.Event_DriverError{DriverError: &protos.DriverError{Error: err.Error()}}})
+	}
 	return
 }
+
+// Helper function to notify subscribers of the number of queued messages
+func (a *application) publishQueueLength() {
+	a.events.Publish(&protos.Event{Payload: &protos.Event_QueueLength{QueueLength: uint32(a.queue.Len())}})
+}
@@ -1,45 +1,67 @@
 package internal
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/briggySmalls/flipdot/app/internal/button"
 	"github.com/briggySmalls/flipdot/app/internal/client"
+	"github.com/briggySmalls/flipdot/app/internal/events"
 	"github.com/briggySmalls/flipdot/app/internal/imaging"
+	"github.com/briggySmalls/flipdot/app/internal/mode"
 	"github.com/briggySmalls/flipdot/app/internal/protos"
+	"github.com/briggySmalls/flipdot/app/internal/queue"
+	"github.com/briggySmalls/flipdot/app/internal/schedule"
 	gomock "github.com/golang/mock/gomock"
+	"github.com/golang/protobuf/ptypes"
 	"golang.org/x/image/font"
 	"golang.org/x/image/font/inconsolata"
 )
 
 func TestTickText(t *testing.T) {
 	// Create mocks
-	ctrl, fakeFlipdot, fakeBm, fakeImager, app := createAppTestObjects(t)
+	q, s, cleanup := createTestStores(t)
+	defer cleanup()
+	ctrl, fakeFlipdot, fakeBm, fakeImager, app := createAppTestObjects(t, q, s)
 	defer ctrl.Finish()
-	defer close(app.GetMessagesChannel())
 	// Create a channel to signal the test is complete
 	textWritten := make(chan struct{})
-	defer close(textWritten)
-	// Configure imager mock to expect request to build images
+	// Configure imager mock to expect requests to build images
 	// Return two 'images' to be displayed
 	fakeImager.EXPECT().Clock(gomock.Any(), false).Return([]*protos.Image{
 		{Data: make([]bool, 10)},
 		{Data: make([]bool, 10)},
-	}, nil)
-	// Configure the mock (calls 'done' when executed)
-	mockAction := func(images []*protos.Image, isWait bool) {
+	}, nil).MinTimes(1)
+	// Configure the mock (signals 'done' when executed)
+	mockAction := func(ctx context.Context, images []*protos.Image, isWait bool) {
 		// Assert that the images are as expected
 		if len(images) != 2 {
 			t.Errorf("Unexpected number of images: %d", len(images))
 		}
-		// Finish up
-		textWritten <- struct{}{}
+		// Finish up, unless already done
+		select {
+		case textWritten <- struct{}{}:
+		default:
+		}
 	}
 	fakeBm.EXPECT().GetChannel()
-	fakeFlipdot.EXPECT().Draw(gomock.Any(), false).Do(mockAction).Return(nil)
-	// Run
-	go app.Run(time.Millisecond)
+	fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), false).Do(mockAction).Return(2, nil).MinTimes(1)
+	// Run, stopping the app before the mocks are checked
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		app.Run(ctx, time.Millisecond)
+		close(stopped)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
 	// Wait until the message is handled, or timeout
 	select {
 	case <-textWritten:
@@ -53,31 +75,33 @@ func TestTickText(t *testing.T) {
 
 func TestMessageTextQueued(t *testing.T) {
 	// Create mocks
-	ctrl, fakeFlipdot, fakeBm, fakeImager, app := createAppTestObjects(t)
+	q, s, cleanup := createTestStores(t)
+	defer cleanup()
+	ctrl, fakeFlipdot, fakeBm, fakeImager, app := createAppTestObjects(t, q, s)
 	defer ctrl.Finish()
 	// Create a channel to signal the test is complete
 	messageAdded := make(chan struct{})
 	defer close(messageAdded)
 	// Configure mock to expect a call to activate button
 	gomock.InOrder(
-		fakeBm.EXPECT().GetChannel(),                   // Expect setup to fetch channel (before loop)
-		fakeImager.EXPECT().Clock(gomock.Any(), false), // Expect clock image to be built (before loop)
-		fakeFlipdot.EXPECT().Draw(gomock.Any(), false), // Expect clock image to be drawn (before loop)
-		fakeBm.EXPECT().SetState(button.Active),        // Expect button to be activated
-		fakeImager.EXPECT().Clock(gomock.Any(), true),  // Expect clock image to be built
-		fakeFlipdot.EXPECT().Draw(gomock.Any(), false).Do(func(interface{}, bool) {
+		fakeBm.EXPECT().GetChannel(),                                 // Expect setup to fetch channel (before loop)
+		fakeImager.EXPECT().Clock(gomock.Any(), false),               // Expect clock image to be built (before loop)
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), false), // Expect clock image to be drawn (before loop)
+		fakeBm.EXPECT().SetState(button.Active),                      // Expect button to be activated
+		fakeImager.EXPECT().Clock(gomock.Any(), true),                // Expect clock image to be built
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), false).Do(func(context.Context, interface{}, bool) {
 			// We are done testing
 			messageAdded <- struct{}{}
 		}), // Expect clock images to be sent
 	)
 	// Run
-	go app.Run(time.Millisecond)
+	go app.Run(context.Background(), time.Hour)
 	// Send the message
 	messagesIn := app.GetMessagesChannel()
 	defer close(messagesIn)
 	messagesIn <- protos.MessageRequest{
 		From:    "briggySmalls",
-		Payload: &protos.MessageRequest_Text{"test text"},
+		Payload: &protos.MessageRequest_Text{Text: "test text"},
 	}
 	// Wait until the message is handled, or timeout
 	select {
@@ -92,7 +116,9 @@ func TestMessageTextQueued(t *testing.T) {
 
 func TestMessageTextSent(t *testing.T) {
 	// Create mocks
-	ctrl, fakeFlipdot, fakeBm, fakeImager, app := createAppTestObjects(t)
+	q, s, cleanup := createTestStores(t)
+	defer cleanup()
+	ctrl, fakeFlipdot, fakeBm, fakeImager, app := createAppTestObjects(t, q, s)
 	defer ctrl.Finish()
 	// Create a channel to signal the test is complete
 	textWritten := make(chan struct{})
@@ -105,38 +131,38 @@ func TestMessageTextSent(t *testing.T) {
 	// Configure startup mocks
 	buttonPress := make(chan struct{}) // Create a channel to signal a button press
 	gomock.InOrder(
-		fakeBm.EXPECT().GetChannel().Return(buttonPress), // Pass button press channel to app, when asked
-		fakeImager.EXPECT().Clock(gomock.Any(), false),   // Expect clock image to be built
-		fakeFlipdot.EXPECT().Draw(gomock.Any(), false),   // Expect clock images to be sent
+		fakeBm.EXPECT().GetChannel().Return(buttonPress),             // Pass button press channel to app, when asked
+		fakeImager.EXPECT().Clock(gomock.Any(), false),               // Expect clock image to be built
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), false), // Expect clock images to be sent
 		fakeBm.EXPECT().SetState(button.Active).Do(func(interface{}) {
 			// Signal to main thread that button was activated
 			// Note: Can't message buttonPress in this callback as we get deadlock
 			activated <- struct{}{}
 		}), // Expect button to be activated after receiving message,
-		fakeImager.EXPECT().Clock(gomock.Any(), true),  // Expect clock image to be built
-		fakeFlipdot.EXPECT().Draw(gomock.Any(), false), // Expect clock images to be sent
-		fakeBm.EXPECT().SetState(button.Inactive),      // Expect dectivate before drawing message
+		fakeImager.EXPECT().Clock(gomock.Any(), true),                // Expect clock image to be built
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), false), // Expect clock images to be sent
+		fakeBm.EXPECT().SetState(button.Inactive),                    // Expect dectivate before drawing message
 		fakeImager.EXPECT().Message("briggySmalls", "test text").Return([]*protos.Image{ // Expect constructing message images
 			{Data: make([]bool, 10)},
 			{Data: make([]bool, 10)},
 			{Data: make([]bool, 10)},
 			{Data: make([]bool, 10)},
 		}, nil),
-		fakeFlipdot.EXPECT().Draw(gomock.Any(), true).Do(func(images []*protos.Image, isWait bool) { // Expect draw message images
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), true).Do(func(ctx context.Context, images []*protos.Image, isWait bool) { // Expect draw message images
 			// Check image
 			if len(images) != 4 {
 				t.Errorf("Unexpected number of images: %d", len(images))
 			}
 			// signal we are done
 			textWritten <- struct{}{}
-		}).Return(nil),
+		}).Return(4, nil),
 	)
 	// Start the app
-	go app.Run(time.Hour)
+	go app.Run(context.Background(), time.Hour)
 	// Send a message to start the test (note: we don't assert as we check this in previous test)
 	messagesIn <- protos.MessageRequest{
 		From:    "briggySmalls",
-		Payload: &protos.MessageRequest_Text{"test text"},
+		Payload: &protos.MessageRequest_Text{Text: "test text"},
 	}
 	// Wait until the message is handled, or timeout
 	for {
@@ -145,7 +171,10 @@ func TestMessageTextSent(t *testing.T) {
 			// Button is now active, so press button
 			buttonPress <- struct{}{}
 		case <-textWritten:
-			// Completed successfully, stop the app
+			// Check the message was removed from the queue (waiting for the app to finish with it)
+			if messages := listMessages(t, app); len(messages) != 0 {
+				t.Errorf("Unexpected number of messages: %d", len(messages))
+			}
 			return
 		case <-time.After(time.Second * 5):
 			// Timeout before we completed
@@ -154,17 +183,839 @@ func TestMessageTextSent(t *testing.T) {
 	}
 }
 
-func createAppTestObjects(t *testing.T) (*gomock.Controller, *client.MockFlipdot, *button.MockButtonManager, *imaging.MockImager, Application) {
+func TestMessageKeptOnDriverError(t *testing.T) {
+	// Create mocks
+	q, s, cleanup := createTestStores(t)
+	defer cleanup()
+	ctrl, fakeFlipdot, fakeBm, fakeImager, app := createAppTestObjects(t, q, s)
+	defer ctrl.Finish()
+	// Create channels to signal the progress of the test
+	activated := make(chan struct{})
+	defer close(activated)
+	reactivated := make(chan struct{})
+	defer close(reactivated)
+	// Get channel to pass messages through
+	messagesIn := app.GetMessagesChannel()
+	defer close(messagesIn)
+	// Configure mocks
+	buttonPress := make(chan struct{})
+	gomock.InOrder(
+		fakeBm.EXPECT().GetChannel().Return(buttonPress),
+		fakeImager.EXPECT().Clock(gomock.Any(), false),
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), false),
+		fakeBm.EXPECT().SetState(button.Active).Do(func(interface{}) {
+			activated <- struct{}{}
+		}),
+		fakeImager.EXPECT().Clock(gomock.Any(), true),
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), false),
+		fakeBm.EXPECT().SetState(button.Inactive),
+		fakeImager.EXPECT().Message("briggySmalls", "test text").Return([]*protos.Image{{Data: make([]bool, 10)}}, nil),
+		// The driver has gone away
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), true).Return(0, client.ErrDriverUnavailable),
+		// Expect the button to be reactivated, so the message can be shown later
+		fakeBm.EXPECT().SetState(button.Active).Do(func(interface{}) {
+			reactivated <- struct{}{}
+		}),
+	)
+	// Start the app
+	go app.Run(context.Background(), time.Hour)
+	messagesIn <- protos.MessageRequest{
+		From:    "briggySmalls",
+		Payload: &protos.MessageRequest_Text{Text: "test text"},
+	}
+	// Wait until the message is handled, or timeout
+	for {
+		select {
+		case <-activated:
+			buttonPress <- struct{}{}
+		case <-reactivated:
+			// Check the message is still queued
+			if messages := listMessages(t, app); len(messages) != 1 {
+				t.Errorf("Unexpected number of messages: %d", len(messages))
+			}
+			return
+		case <-time.After(time.Second * 5):
+			t.Fatal("Timeout before expected call")
+		}
+	}
+}
+
+func TestMessageFailed(t *testing.T) {
+	// Create mocks
+	q, s, cleanup := createTestStores(t)
+	defer cleanup()
+	ctrl, fakeFlipdot, fakeBm, fakeImager, app := createAppTestObjects(t, q, s)
+	defer ctrl.Finish()
+	// Subscribe to events
+	events, unsubscribe := app.SubscribeEvents()
+	defer unsubscribe()
+	// Get channel to pass messages through
+	messagesIn := app.GetMessagesChannel()
+	defer close(messagesIn)
+	// Expect the message to fail to render, then be retried
+	gomock.InOrder(
+		fakeBm.EXPECT().GetChannel(),
+		fakeImager.EXPECT().Clock(gomock.Any(), false),
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), false),
+		fakeBm.EXPECT().SetState(button.Inactive),
+		fakeImager.EXPECT().Message("briggySmalls", "test text").Return(nil, fmt.Errorf("Unknown glyph")),
+		// The retried message is waiting to be shown
+		fakeBm.EXPECT().SetState(button.Active),
+		fakeImager.EXPECT().Clock(gomock.Any(), true),
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), false),
+	)
+	// Run
+	go app.Run(context.Background(), time.Hour)
+	// Send an urgent message, so it is shown immediately
+	messagesIn <- protos.MessageRequest{
+		From:     "briggySmalls",
+		Payload:  &protos.MessageRequest_Text{Text: "test text"},
+		Priority: protos.MessageRequest_URGENT,
+	}
+	// Check the failure is announced
+	for failed := false; !failed; {
+		select {
+		case event := <-events:
+			if event.GetMessageFailed() != nil {
+				failed = true
+				if event.GetMessageFailed().Retrying || event.GetMessageFailed().Error != "Unknown glyph" {
+					t.Errorf("Unexpected event: %s", event.String())
+				}
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Timeout before expected event")
+		}
+	}
+	// Check the message was set aside
+	if len(listMessages(t, app)) != 0 {
+		t.Errorf("Unexpected number of messages: %d", len(listMessages(t, app)))
+	}
+	failed := listFailedMessages(t, app)
+	if len(failed) != 1 {
+		t.Fatalf("Unexpected number of failed messages: %d", len(failed))
+	}
+	// Check the message can be queued again
+	failOnError(app.RetryFailedMessage(context.Background(), failed[0].Message.Id), t)
+	if len(listMessages(t, app)) != 1 || len(listFailedMessages(t, app)) != 0 {
+		t.Error("Failed message not queued again")
+	}
+}
+
+func TestUrgentMessageInterrupts(t *testing.T) {
+	// Create mocks
+	q, s, cleanup := createTestStores(t)
+	defer cleanup()
+	ctrl, fakeFlipdot, fakeBm, fakeImager, app := createAppTestObjects(t, q, s)
+	defer ctrl.Finish()
+	// Create channels to signal the progress of the test
+	drawing := make(chan struct{})
+	defer close(drawing)
+	done := make(chan struct{})
+	defer close(done)
+	// Get channel to pass messages through
+	messagesIn := app.GetMessagesChannel()
+	defer close(messagesIn)
+	// Expect the first message to be abandoned part way through for the second
+	gomock.InOrder(
+		fakeBm.EXPECT().GetChannel(),
+		fakeImager.EXPECT().Clock(gomock.Any(), false),
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), false),
+		fakeBm.EXPECT().SetState(button.Inactive),
+		fakeImager.EXPECT().Message("briggySmalls", "first").Return([]*protos.Image{{Data: make([]bool, 10)}, {Data: make([]bool, 10)}}, nil),
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), true).DoAndReturn(func(ctx context.Context, images []*protos.Image, isWait bool) (int, error) {
+			// Keep drawing until interrupted
+			drawing <- struct{}{}
+			<-ctx.Done()
+			return 1, ctx.Err()
+		}),
+		// The first message is waiting to be shown again
+		fakeBm.EXPECT().SetState(button.Active),
+		fakeBm.EXPECT().SetState(button.Inactive),
+		fakeImager.EXPECT().Message("briggySmalls", "second").Return([]*protos.Image{{Data: make([]bool, 10)}}, nil),
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), true).Return(1, nil),
+		fakeBm.EXPECT().SetState(button.Active).Do(func(interface{}) {
+			done <- struct{}{}
+		}),
+	)
+	// Run
+	go app.Run(context.Background(), time.Hour)
+	for _, text := range []string{"first", "second"} {
+		messagesIn <- protos.MessageRequest{
+			From:     "briggySmalls",
+			Payload:  &protos.MessageRequest_Text{Text: text},
+			Priority: protos.MessageRequest_URGENT,
+		}
+		if text == "first" {
+			// Wait until the first message is being drawn
+			select {
+			case <-drawing:
+			case <-time.After(time.Second):
+				t.Fatal("Timeout before expected call")
+			}
+		}
+	}
+	// Wait until the second message is shown
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Timeout before expected call")
+	}
+	// Check the first message is still queued
+	messages := listMessages(t, app)
+	if len(messages) != 1 || messages[0].Message.GetText() != "first" {
+		t.Errorf("Unexpected messages: %v", messages)
+	}
+}
+
+func TestUrgentMessageInterruptsBehindOthers(t *testing.T) {
+	// Create mocks
+	q, s, cleanup := createTestStores(t)
+	defer cleanup()
+	ctrl, fakeFlipdot, fakeBm, fakeImager, app := createAppTestObjects(t, q, s)
+	defer ctrl.Finish()
+	// Create channels to signal the progress of the test
+	drawing := make(chan struct{}, 1)
+	interrupted := make(chan struct{})
+	// Get channel to pass messages through
+	messagesIn := app.GetMessagesChannel()
+	// Expect the first message to be drawn slowly, until interrupted
+	gomock.InOrder(
+		fakeBm.EXPECT().GetChannel(),
+		fakeImager.EXPECT().Clock(gomock.Any(), false),
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), false),
+		fakeBm.EXPECT().SetState(button.Inactive),
+		fakeImager.EXPECT().Message("briggySmalls", "first").Return([]*protos.Image{{Data: make([]bool, 10)}}, nil),
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), true).DoAndReturn(func(ctx context.Context, images []*protos.Image, isWait bool) (int, error) {
+			drawing <- struct{}{}
+			select {
+			case <-ctx.Done():
+				close(interrupted)
+				return 0, ctx.Err()
+			case <-time.After(3 * time.Second):
+				return 1, nil
+			}
+		}),
+	)
+	// Don't mind how the remaining messages are handled
+	fakeBm.EXPECT().SetState(gomock.Any()).AnyTimes()
+	fakeImager.EXPECT().Clock(gomock.Any(), gomock.Any()).AnyTimes()
+	fakeImager.EXPECT().Message(gomock.Any(), gomock.Any()).AnyTimes()
+	fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	// Run
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go app.Run(ctx, time.Hour)
+	messagesIn <- protos.MessageRequest{
+		From:     "briggySmalls",
+		Payload:  &protos.MessageRequest_Text{Text: "first"},
+		Priority: protos.MessageRequest_URGENT,
+	}
+	select {
+	case <-drawing:
+	case <-time.After(time.Second):
+		t.Fatal("Timeout before expected call")
+	}
+	// Send a normal message, then an urgent one behind it
+	for _, priority := range []protos.MessageRequest_Priority{protos.MessageRequest_NORMAL, protos.MessageRequest_URGENT} {
+		messagesIn <- protos.MessageRequest{
+			From:     "briggySmalls",
+			Payload:  &protos.MessageRequest_Text{Text: priority.String()},
+			Priority: priority,
+		}
+	}
+	// Check the first message is interrupted straight away
+	select {
+	case <-interrupted:
+	case <-time.After(time.Second):
+		t.Fatal("Urgent message did not interrupt")
+	}
+}
+
+func TestMessageEvents(t *testing.T) {
+	// Create mocks
+	q, s, cleanup := createTestStores(t)
+	defer cleanup()
+	ctrl, fakeFlipdot, fakeBm, fakeImager, app := createAppTestObjects(t, q, s)
+	defer ctrl.Finish()
+	// Subscribe to events
+	events, unsubscribe := app.SubscribeEvents()
+	defer unsubscribe()
+	// Get channel to pass messages through
+	messagesIn := app.GetMessagesChannel()
+	defer close(messagesIn)
+	// Configure mocks
+	fakeBm.EXPECT().GetChannel()
+	fakeBm.EXPECT().SetState(button.Active)
+	fakeImager.EXPECT().Clock(gomock.Any(), gomock.Any()).Times(2)
+	fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), false).Times(2)
+	// Run
+	go app.Run(context.Background(), time.Hour)
+	// Send a message
+	messagesIn <- protos.MessageRequest{
+		From:    "briggySmalls",
+		Payload: &protos.MessageRequest_Text{Text: "test text"},
+	}
+	// Check the message and new queue length are announced
+	for _, check := range []func(*protos.Event) bool{
+		func(e *protos.Event) bool { return e.GetMessageQueued().GetMessage().GetText() == "test text" },
+		func(e *protos.Event) bool { return e.GetQueueLength() == 1 },
+	} {
+		select {
+		case event := <-events:
+			if !check(event) {
+				t.Errorf("Unexpected event: %s", event.String())
+			}
+		case <-time.After(time.Second):
+			// Timeout before we completed
+			t.Fatal("Timeout before expected event")
+		}
+	}
+}
+
+func TestMessageUrgent(t *testing.T) {
+	// Create mocks
+	q, s, cleanup := createTestStores(t)
+	defer cleanup()
+	ctrl, fakeFlipdot, fakeBm, fakeImager, app := createAppTestObjects(t, q, s)
+	defer ctrl.Finish()
+	// Create a channel to signal the test is complete
+	textWritten := make(chan struct{})
+	defer close(textWritten)
+	// Get channel to pass messages through
+	messagesIn := app.GetMessagesChannel()
+	defer close(messagesIn)
+	// Expect the message to be drawn without the button being activated
+	gomock.InOrder(
+		fakeBm.EXPECT().GetChannel(),                                 // Expect setup to fetch channel (before loop)
+		fakeImager.EXPECT().Clock(gomock.Any(), false),               // Expect clock image to be built (before loop)
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), false), // Expect clock image to be drawn (before loop)
+		fakeBm.EXPECT().SetState(button.Inactive),                    // Expect deactivate before drawing message
+		fakeImager.EXPECT().Message("briggySmalls", "test text").Return([]*protos.Image{
+			{Data: make([]bool, 10)},
+		}, nil), // Expect constructing message images
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), true).Do(func(context.Context, interface{}, bool) {
+			// We are done testing
+			textWritten <- struct{}{}
+		}).Return(2, nil), // Expect draw message images
+	)
+	// Run
+	go app.Run(context.Background(), time.Hour)
+	// Send an urgent message
+	messagesIn <- protos.MessageRequest{
+		From:     "briggySmalls",
+		Payload:  &protos.MessageRequest_Text{Text: "test text"},
+		Priority: protos.MessageRequest_URGENT,
+	}
+	// Wait until the message is handled, or timeout
+	select {
+	case <-textWritten:
+		// Completed successfully
+		return
+	case <-time.After(time.Second):
+		// Timeout before we completed
+		t.Fatal("Timeout before expected call")
+	}
+}
+
+func TestMessageExpired(t *testing.T) {
+	// Create mocks
+	q, s, cleanup := createTestStores(t)
+	defer cleanup()
+	ctrl, fakeFlipdot, fakeBm, fakeImager, app := createAppTestObjects(t, q, s)
+	defer ctrl.Finish()
+	// Create a channel to signal the test is complete
+	statusCleared := make(chan struct{})
+	defer close(statusCleared)
+	activated := make(chan struct{})
+	defer close(activated)
+	// Get channel to pass messages through
+	messagesIn := app.GetMessagesChannel()
+	defer close(messagesIn)
+	// Configure mocks
+	buttonPress := make(chan struct{}) // Create a channel to signal a button press
+	gomock.InOrder(
+		fakeBm.EXPECT().GetChannel().Return(buttonPress),             // Pass button press channel to app, when asked
+		fakeImager.EXPECT().Clock(gomock.Any(), false),               // Expect clock image to be built (before loop)
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), false), // Expect clock image to be drawn (before loop)
+		fakeBm.EXPECT().SetState(button.Active),                      // Expect button to be activated
+		fakeImager.EXPECT().Clock(gomock.Any(), true),                // Expect clock image to be built
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), false).Do(func(context.Context, interface{}, bool) {
+			// Signal to main thread that the message is queued
+			activated <- struct{}{}
+		}), // Expect clock images to be sent
+		fakeBm.EXPECT().SetState(button.Inactive),      // Expect button to be deactivated once expired
+		fakeImager.EXPECT().Clock(gomock.Any(), false), // Expect clock image to be built without status
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), false).Do(func(context.Context, interface{}, bool) {
+			// We are done testing
+			statusCleared <- struct{}{}
+		}), // Expect clock images to be sent (and no message to be drawn)
+	)
+	// Run
+	go app.Run(context.Background(), time.Hour)
+	// Send a message that expires almost immediately
+	messagesIn <- protos.MessageRequest{
+		From:    "briggySmalls",
+		Payload: &protos.MessageRequest_Text{Text: "test text"},
+		Ttl:     ptypes.DurationProto(time.Nanosecond),
+	}
+	for {
+		select {
+		case <-activated:
+			// Button is now active, so press button
+			buttonPress <- struct{}{}
+		case <-statusCleared:
+			// Completed successfully
+			return
+		case <-time.After(time.Second):
+			// Timeout before we completed
+			t.Fatal("Timeout before expected call")
+		}
+	}
+}
+
+func TestMessageScheduled(t *testing.T) {
+	// Create a scheduler with a message that is already due
+	q, s, cleanup := createTestStores(t)
+	defer cleanup()
+	_, err := s.Add(protos.ScheduleRequest{
+		Message: &protos.MessageRequest{
+			From:    "briggySmalls",
+			Payload: &protos.MessageRequest_Text{Text: "test text"},
+		},
+		Schedule: &protos.ScheduleRequest_DisplayAt{DisplayAt: ptypes.TimestampNow()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Create mocks
+	ctrl, fakeFlipdot, fakeBm, fakeImager, app := createAppTestObjects(t, q, s)
+	defer ctrl.Finish()
+	// Create a channel to signal the test is complete
+	messageReleased := make(chan struct{})
+	// Expect the message to be queued on the first tick
+	gomock.InOrder(
+		fakeBm.EXPECT().GetChannel(),                                 // Expect setup to fetch channel (before loop)
+		fakeImager.EXPECT().Clock(gomock.Any(), false),               // Expect clock image to be built (before loop)
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), false), // Expect clock image to be drawn (before loop)
+		fakeBm.EXPECT().SetState(button.Active),                      // Expect button to be activated
+		fakeImager.EXPECT().Clock(gomock.Any(), true),                // Expect clock image to show message status
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), false).Do(func(context.Context, interface{}, bool) {
+			// We are done testing
+			close(messageReleased)
+		}), // Expect clock images to be sent
+	)
+	// Allow the clock to keep ticking afterwards
+	fakeImager.EXPECT().Clock(gomock.Any(), true).AnyTimes()
+	fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), false).AnyTimes()
+	// Run (waiting for the app to stop before the scheduler is closed)
+	stopped := make(chan struct{})
+	go func() {
+		app.Run(context.Background(), time.Millisecond)
+		close(stopped)
+	}()
+	defer func() {
+		close(app.GetMessagesChannel())
+		<-stopped
+	}()
+	// Wait until the message is released, or timeout
+	select {
+	case <-messageReleased:
+		// Check the schedule has been used up
+		if schedules := listSchedules(t, app); len(schedules) != 0 {
+			t.Errorf("Unexpected number of schedules: %d", len(schedules))
+		}
+		if messages := listMessages(t, app); len(messages) != 1 {
+			t.Errorf("Unexpected number of messages: %d", len(messages))
+		}
+	case <-time.After(time.Second):
+		// Timeout before we completed
+		t.Fatal("Timeout before expected call")
+	}
+}
+
+func TestMessageRestored(t *testing.T) {
+	// Create a queue that already holds a message
+	q, s, cleanup := createTestStores(t)
+	defer cleanup()
+	_, err := q.Push(protos.MessageRequest{
+		From:    "briggySmalls",
+		Payload: &protos.MessageRequest_Text{Text: "test text"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Create mocks
+	ctrl, fakeFlipdot, fakeBm, fakeImager, app := createAppTestObjects(t, q, s)
+	defer ctrl.Finish()
+	defer close(app.GetMessagesChannel())
+	// Create a channel to signal the test is complete
+	clockDrawn := make(chan struct{})
+	defer close(clockDrawn)
+	// Expect the button to be activated before anything is received
+	gomock.InOrder(
+		fakeBm.EXPECT().GetChannel(),                  // Expect setup to fetch channel (before loop)
+		fakeBm.EXPECT().SetState(button.Active),       // Expect button to be activated for restored message
+		fakeImager.EXPECT().Clock(gomock.Any(), true), // Expect clock image to show message status
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), false).Do(func(context.Context, interface{}, bool) {
+			// We are done testing
+			clockDrawn <- struct{}{}
+		}), // Expect clock images to be sent
+	)
+	// Run
+	go app.Run(context.Background(), time.Hour)
+	// Wait until the clock is drawn, or timeout
+	select {
+	case <-clockDrawn:
+		// Completed successfully
+		return
+	case <-time.After(time.Second):
+		// Timeout before we completed
+		t.Fatal("Timeout before expected call")
+	}
+}
+
+func TestMessagesCleared(t *testing.T) {
+	// Create mocks
+	q, s, cleanup := createTestStores(t)
+	defer cleanup()
+	ctrl, fakeFlipdot, fakeBm, fakeImager, app := createAppTestObjects(t, q, s)
+	defer ctrl.Finish()
+	// Create a channel to signal the test is complete
+	statusCleared := make(chan struct{})
+	defer close(statusCleared)
+	activated := make(chan struct{})
+	defer close(activated)
+	// Get channel to pass messages through
+	messagesIn := app.GetMessagesChannel()
+	defer close(messagesIn)
+	// Configure mocks
+	gomock.InOrder(
+		fakeBm.EXPECT().GetChannel(),                                 // Expect setup to fetch channel (before loop)
+		fakeImager.EXPECT().Clock(gomock.Any(), false),               // Expect clock image to be built (before loop)
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), false), // Expect clock image to be drawn (before loop)
+		fakeBm.EXPECT().SetState(button.Active),                      // Expect button to be activated
+		fakeImager.EXPECT().Clock(gomock.Any(), true),                // Expect clock image to be built
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), false).Do(func(context.Context, interface{}, bool) {
+			// Signal to main thread that the message is queued
+			activated <- struct{}{}
+		}), // Expect clock images to be sent
+		fakeBm.EXPECT().SetState(button.Inactive),      // Expect button to be deactivated once cleared
+		fakeImager.EXPECT().Clock(gomock.Any(), false), // Expect clock image to be built without status
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), false).Do(func(context.Context, interface{}, bool) {
+			// We are done testing
+			statusCleared <- struct{}{}
+		}), // Expect clock images to be sent
+	)
+	// Run
+	go app.Run(context.Background(), time.Hour)
+	// Send a message
+	messagesIn <- protos.MessageRequest{
+		From:    "briggySmalls",
+		Payload: &protos.MessageRequest_Text{Text: "test text"},
+	}
+	for {
+		select {
+		case <-activated:
+			// Check the message is listed, then clear the queue
+			if messages := listMessages(t, app); len(messages) != 1 {
+				t.Fatalf("Unexpected number of messages: %d", len(messages))
+			}
+			go func() {
+				if err := app.ClearMessages(context.Background()); err != nil {
+					t.Error(err)
+				}
+			}()
+		case <-statusCleared:
+			// Completed successfully
+			return
+		case <-time.After(time.Second):
+			// Timeout before we completed
+			t.Fatal("Timeout before expected call")
+		}
+	}
+}
+
+func TestQuietHours(t *testing.T) {
+	// Create mocks, with a light schedule and quiet hours that cover the whole day
+	q, s, cleanup := createTestStores(t)
+	defer cleanup()
+	allDay := &schedule.Period{Start: 0, End: 24 * time.Hour}
+	ctrl, fakeFlipdot, fakeBm, _, app := createPeriodAppTestObjects(t, q, s, allDay, allDay)
+	defer ctrl.Finish()
+	messagesIn := app.GetMessagesChannel()
+	defer close(messagesIn)
+	// Create a channel to signal the light was turned on
+	lightOn := make(chan struct{})
+	// Expect the light to be turned on, but nothing to be drawn
+	gomock.InOrder(
+		fakeBm.EXPECT().GetChannel(),
+		fakeFlipdot.EXPECT().LightOn().Do(func() { close(lightOn) }).Return(nil),
+	)
+	// Run
+	go app.Run(context.Background(), time.Hour)
+	select {
+	case <-lightOn:
+	case <-time.After(time.Second):
+		t.Fatal("Timeout before light turned on")
+	}
+	// Send an urgent message, which should be held in the queue
+	messagesIn <- protos.MessageRequest{
+		From:     "briggySmalls",
+		Payload:  &protos.MessageRequest_Text{Text: "test text"},
+		Priority: protos.MessageRequest_URGENT,
+	}
+	timeout := time.After(time.Second)
+	for len(listMessages(t, app)) == 0 {
+		select {
+		case <-timeout:
+			t.Fatal("Timeout before message queued")
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func TestModeSwitch(t *testing.T) {
+	// Create mocks
+	q, s, cleanup := createTestStores(t)
+	defer cleanup()
+	ctrl, fakeFlipdot, fakeBm, fakeImager, app := createAppTestObjects(t, q, s)
+	defer ctrl.Finish()
+	defer close(app.GetMessagesChannel())
+	// Create a channel to signal the test is complete
+	quoteDrawn := make(chan struct{})
+	// Expect the clock to be drawn, and then the quote once switched
+	gomock.InOrder(
+		fakeBm.EXPECT().GetChannel(),
+		fakeImager.EXPECT().Clock(gomock.Any(), false),
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), false),
+		fakeImager.EXPECT().Text("hello", false),
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), false).Do(func(context.Context, interface{}, bool) {
+			close(quoteDrawn)
+		}),
+	)
+	// Run
+	go app.Run(context.Background(), time.Hour)
+	// Check unknown modes are rejected
+	if err := app.SetMode(context.Background(), "weather"); err != mode.ErrModeNotFound {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	// Switch modes
+	failOnError(app.SetMode(context.Background(), "quote"), t)
+	select {
+	case <-quoteDrawn:
+	case <-time.After(time.Second):
+		t.Fatal("Timeout before expected call")
+	}
+	name, available, err := app.GetMode(context.Background())
+	failOnError(err, t)
+	if name != "quote" || len(available) != 2 {
+		t.Errorf("Unexpected mode: %s (of %v)", name, available)
+	}
+}
+
+func TestPlaylist(t *testing.T) {
+	// Create mocks
+	q, s, cleanup := createTestStores(t)
+	defer cleanup()
+	ctrl, fakeFlipdot, fakeBm, fakeImager, app := createAppTestObjects(t, q, s)
+	defer ctrl.Finish()
+	defer close(app.GetMessagesChannel())
+	// Create a channel to signal the test is complete
+	quoteDrawn := make(chan struct{})
+	// Expect the clock to be drawn, and then the quote once the playlist starts
+	gomock.InOrder(
+		fakeBm.EXPECT().GetChannel(),
+		fakeImager.EXPECT().Clock(gomock.Any(), false),
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), false),
+		fakeImager.EXPECT().Text("hello", false),
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), false).Do(func(context.Context, interface{}, bool) {
+			close(quoteDrawn)
+		}),
+	)
+	// Run
+	go app.Run(context.Background(), time.Hour)
+	// Check playlists with unknown modes are rejected
+	err := app.SetPlaylist(context.Background(), []*protos.Playlist_Entry{{Mode: "weather", Duration: ptypes.DurationProto(time.Minute)}})
+	if err != mode.ErrModeNotFound {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	// Start a playlist
+	entries := []*protos.Playlist_Entry{
+		{Mode: "quote", Duration: ptypes.DurationProto(time.Minute)},
+		{Mode: "clock", Duration: ptypes.DurationProto(time.Minute)},
+	}
+	failOnError(app.SetPlaylist(context.Background(), entries), t)
+	select {
+	case <-quoteDrawn:
+	case <-time.After(time.Second):
+		t.Fatal("Timeout before expected call")
+	}
+	if playlist := getPlaylist(t, app); len(playlist) != 2 {
+		t.Errorf("Unexpected playlist: %v", playlist)
+	}
+	// Check choosing a mode stops the rotation
+	failOnError(app.SetMode(context.Background(), "quote"), t)
+	if playlist := getPlaylist(t, app); len(playlist) != 0 {
+		t.Errorf("Unexpected playlist: %v", playlist)
+	}
+}
+
+func TestPlaylistSwitch(t *testing.T) {
+	// Create mocks
+	q, s, cleanup := createTestStores(t)
+	defer cleanup()
+	ctrl, fakeFlipdot, fakeBm, fakeImager, app := createAppTestObjects(t, q, s)
+	defer ctrl.Finish()
+	defer close(app.GetMessagesChannel())
+	// Create a channel to signal the test is complete
+	clockDrawn := make(chan struct{})
+	// Expect the quote to be drawn, and then the clock once the quote's entry ends
+	var quoteTime time.Time
+	gomock.InOrder(
+		fakeBm.EXPECT().GetChannel(),
+		fakeImager.EXPECT().Clock(gomock.Any(), false),
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), false),
+		fakeImager.EXPECT().Text("hello", false),
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), false).Do(func(context.Context, interface{}, bool) {
+			quoteTime = time.Now()
+		}),
+		fakeImager.EXPECT().Clock(gomock.Any(), false),
+		fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), false).Do(func(context.Context, interface{}, bool) {
+			close(clockDrawn)
+		}),
+	)
+	// Run, with ticks too infrequent to switch entries
+	go app.Run(context.Background(), time.Hour)
+	// Start a playlist
+	entries := []*protos.Playlist_Entry{
+		{Mode: "quote", Duration: ptypes.DurationProto(100 * time.Millisecond)},
+		{Mode: "clock", Duration: ptypes.DurationProto(time.Hour)},
+	}
+	failOnError(app.SetPlaylist(context.Background(), entries), t)
+	select {
+	case <-clockDrawn:
+	case <-time.After(time.Second):
+		t.Fatal("Timeout before expected call")
+	}
+	// Check the quote was shown for its full duration
+	if elapsed := time.Since(quoteTime); elapsed < 90*time.Millisecond {
+		t.Errorf("Switched after only %s", elapsed)
+	}
+}
+
+func TestActionsGiveUp(t *testing.T) {
+	// Create mocks
+	q, s, cleanup := createTestStores(t)
+	defer cleanup()
+	ctrl, fakeFlipdot, fakeBm, fakeImager, app := createAppTestObjects(t, q, s)
+	defer ctrl.Finish()
+	// Check callers don't wait forever for a loop that isn't running
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := app.ListMessages(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	// Run the loop until it is stopped
+	fakeBm.EXPECT().GetChannel()
+	fakeImager.EXPECT().Clock(gomock.Any(), false)
+	fakeFlipdot.EXPECT().Draw(gomock.Any(), gomock.Any(), false)
+	stopped, stop := context.WithCancel(context.Background())
+	stop()
+	app.Run(stopped, time.Hour)
+	// Check callers are told the loop has stopped
+	if err := app.ClearMessages(context.Background()); err != ErrStopped {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func createAppTestObjects(t *testing.T, q queue.MessageQueue, s schedule.Scheduler) (*gomock.Controller, *client.MockFlipdot, *button.MockButtonManager, *imaging.MockImager, Application) {
+	return createPeriodAppTestObjects(t, q, s, nil, nil)
+}
+
+// Helper function to set up the unit under test with a light schedule and quiet hours
+func createPeriodAppTestObjects(t *testing.T, q queue.MessageQueue, s schedule.Scheduler, lightPeriod, quietPeriod *schedule.Period) (*gomock.Controller, *client.MockFlipdot, *button.MockButtonManager, *imaging.MockImager, Application) {
 	// Create a mock
 	ctrl := gomock.NewController(t)
 	fakeFlipdot := client.NewMockFlipdot(ctrl)
 	fakeBm := button.NewMockButtonManager(ctrl)
 	fakeImager := imaging.NewMockImager(ctrl)
 	// Create object under test
-	app := NewApplication(fakeFlipdot, fakeBm, fakeImager)
+	// Create some modes to display
+	modes := mode.NewRegistry()
+	failOnError(modes.Register("clock", mode.NewClock(fakeImager)), t)
+	failOnError(modes.Register("quote", mode.NewText(fakeImager, "hello")), t)
+	app, err := NewApplication(fakeFlipdot, fakeBm, fakeImager, q, s, events.NewHub(20), lightPeriod, quietPeriod, modes, "clock", nil)
+	failOnError(err, t)
 	return ctrl, fakeFlipdot, fakeBm, fakeImager, app
 }
 
+// Helper function to create a queue and scheduler in a temporary directory
+func createTestStores(t *testing.T) (queue.MessageQueue, schedule.Scheduler, func()) {
+	dir, err := ioutil.TempDir("", "flipapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := queue.NewMessageQueue(filepath.Join(dir, "queue.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	s, err := schedule.NewScheduler(filepath.Join(dir, "schedule.db"))
+	if err != nil {
+		q.Close()
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return q, s, func() {
+		q.Close()
+		s.Close()
+		os.RemoveAll(dir)
+	}
+}
+
 func getTestFont() font.Face {
 	return inconsolata.Regular8x16
 }
+
+// Helper function to stop a test in the event of an error
+func failOnError(err error, t *testing.T) {
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Helper function to list the queued messages, failing the test on error
+func listMessages(t *testing.T, app Application) []*protos.QueuedMessage {
+	messages, err := app.ListMessages(context.Background())
+	if err != nil {
+		t.Error(err)
+	}
+	return messages
+}
+
+// Helper function to list the failed messages, failing the test on error
+func listFailedMessages(t *testing.T, app Application) []*protos.FailedMessage {
+	messages, err := app.ListFailedMessages(context.Background())
+	if err != nil {
+		t.Error(err)
+	}
+	return messages
+}
+
+// Helper function to list the scheduled messages, failing the test on error
+func listSchedules(t *testing.T, app Application) []*protos.ScheduledMessage {
+	schedules, err := app.ListSchedules(context.Background())
+	if err != nil {
+		t.Error(err)
+	}
+	return schedules
+}
+
+// Helper function to get the playlist, failing the test on error
+func getPlaylist(t *testing.T, app Application) []*protos.Playlist_Entry {
+	entries, err := app.GetPlaylist(context.Background())
+	if err != nil {
+		t.Error(err)
+	}
+	return entries
+}
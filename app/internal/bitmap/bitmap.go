@@ -0,0 +1,248 @@
+package bitmap
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/briggySmalls/flipdot/app/internal/protos"
+)
+
+// Largest image, in pixels, that may be unpacked without knowing the size of the sign it is for
+const MaxPixels = 1 << 20
+
+// Pack C-style image data into a bitmap of the specified dimensions
+func Pack(data []bool, width, height uint, order protos.Bitmap_Order, compression protos.Bitmap_Compression) (*protos.Bitmap, error) {
+	if uint64(len(data)) != uint64(width)*uint64(height) {
+		return nil, fmt.Errorf("Image has %d pixels, expected %dx%d", len(data), width, height)
+	}
+	// Put the pixels in the requested order
+	pixels := data
+	if order == protos.Bitmap_COLUMN_MAJOR {
+		pixels = make([]bool, len(data))
+		for r := uint(0); r < height; r++ {
+			for c := uint(0); c < width; c++ {
+				pixels[c*height+r] = data[r*width+c]
+			}
+		}
+	}
+	b := protos.Bitmap{
+		Width:       uint32(width),
+		Height:      uint32(height),
+		Order:       order,
+		Compression: compression,
+	}
+	switch compression {
+	case protos.Bitmap_NONE:
+		b.Data = packBits(pixels)
+	case protos.Bitmap_RUN_LENGTH:
+		b.Data = packRuns(pixels)
+	default:
+		return nil, fmt.Errorf("Unknown compression: %s", compression)
+	}
+	return &b, nil
+}
+
+// Unpack a bitmap of at most the specified number of pixels into C-style image data
+func Unpack(b *protos.Bitmap, max uint64) (data []bool, err error) {
+	// Check the size before allocating anything, as it comes from the client
+	if uint64(b.Width)*uint64(b.Height) > max {
+		return nil, fmt.Errorf("Bitmap is %dx%d, larger than %d pixels", b.Width, b.Height, max)
+	}
+	count := uint(b.Width) * uint(b.Height)
+	// Every run takes at least a byte, and covers at least one pixel (bar the first)
+	if uint64(len(b.Data)) > uint64(count)+1 {
+		return nil, fmt.Errorf("Bitmap has %d bytes, too many for %d pixels", len(b.Data), count)
+	}
+	var pixels []bool
+	switch b.Compression {
+	case protos.Bitmap_NONE:
+		pixels, err = unpackBits(b.Data, count)
+	case protos.Bitmap_RUN_LENGTH:
+		pixels, err = unpackRuns(b.Data, count)
+	default:
+		err = fmt.Errorf("Unknown compression: %s", b.Compression)
+	}
+	if err != nil {
+		return
+	}
+	switch b.Order {
+	case protos.Bitmap_ROW_MAJOR:
+		return pixels, nil
+	case protos.Bitmap_COLUMN_MAJOR:
+		width, height := uint(b.Width), uint(b.Height)
+		data = make([]bool, count)
+		for r := uint(0); r < height; r++ {
+			for c := uint(0); c < width; c++ {
+				data[r*width+c] = pixels[c*height+r]
+			}
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("Unknown order: %s", b.Order)
+	}
+}
+
+// Get the C-style data of an image of at most the specified number of pixels, whichever way it is encoded
+func Pixels(image *protos.Image, max uint64) ([]bool, error) {
+	if image.GetBitmap() == nil {
+		if uint64(len(image.GetData())) > max {
+			return nil, fmt.Errorf("Image has %d pixels, more than %d", len(image.GetData()), max)
+		}
+		return image.GetData(), nil
+	}
+	return Unpack(image.Bitmap, max)
+}
+
+// Get an image of at most the specified number of pixels that carries C-style data, unpacking its bitmap if it has one
+func Unpacked(image *protos.Image, max uint64) (*protos.Image, error) {
+	if image.GetBitmap() == nil {
+		if uint64(len(image.GetData())) > max {
+			return nil, fmt.Errorf("Image has %d pixels, more than %d", len(image.GetData()), max)
+		}
+		return image, nil
+	}
+	data, err := Unpack(image.Bitmap, max)
+	if err != nil {
+		return nil, err
+	}
+	return &protos.Image{Data: data}, nil
+}
+
+// Get an image that carries a compressed bitmap of the specified dimensions
+func Packed(image *protos.Image, width, height uint) (*protos.Image, error) {
+	if image.GetBitmap() != nil {
+		return image, nil
+	}
+	b, err := Pack(image.Data, width, height, protos.Bitmap_ROW_MAJOR, protos.Bitmap_RUN_LENGTH)
+	if err != nil {
+		return nil, err
+	}
+	return &protos.Image{Bitmap: b}, nil
+}
+
+// Crop or pad C-style image data to the specified dimensions, keeping the top-left corner
+func Resize(data []bool, width, height, toWidth, toHeight uint) []bool {
+	resized := make([]bool, toWidth*toHeight)
+	for r := uint(0); r < height && r < toHeight; r++ {
+		for c := uint(0); c < width && c < toWidth; c++ {
+			resized[r*toWidth+c] = data[r*width+c]
+		}
+	}
+	return resized
+}
+
+// Find the smallest region containing every pixel that differs between two images (nil if none do)
+func Changed(a, b []bool, width, height uint) *protos.Region {
+	left, top, right, bottom := width, height, uint(0), uint(0)
+	for r := uint(0); r < height; r++ {
+		for c := uint(0); c < width; c++ {
+			if a[r*width+c] == b[r*width+c] {
+				continue
+			}
+			if c < left {
+				left = c
+			}
+			if c >= right {
+				right = c + 1
+			}
+			if r < top {
+				top = r
+			}
+			if r >= bottom {
+				bottom = r + 1
+			}
+		}
+	}
+	if right == 0 {
+		return nil
+	}
+	return &protos.Region{
+		X:      uint32(left),
+		Y:      uint32(top),
+		Width:  uint32(right - left),
+		Height: uint32(bottom - top),
+	}
+}
+
+// Take the pixels within a region of C-style image data
+func Crop(data []bool, width uint, region *protos.Region) []bool {
+	x, y := uint(region.X), uint(region.Y)
+	w, h := uint(region.Width), uint(region.Height)
+	cropped := make([]bool, 0, w*h)
+	for r := y; r < y+h; r++ {
+		cropped = append(cropped, data[r*width+x:r*width+x+w]...)
+	}
+	return cropped
+}
+
+// Copy C-style image data, replacing the pixels within a region with those of a patch
+func Paste(data []bool, width uint, region *protos.Region, patch []bool) []bool {
+	x, y := uint(region.X), uint(region.Y)
+	w, h := uint(region.Width), uint(region.Height)
+	pasted := append([]bool{}, data...)
+	for r := uint(0); r < h; r++ {
+		copy(pasted[(y+r)*width+x:(y+r)*width+x+w], patch[r*w:(r+1)*w])
+	}
+	return pasted
+}
+
+// Pack pixels into bits, the first in the most significant bit
+func packBits(pixels []bool) []byte {
+	packed := make([]byte, (len(pixels)+7)/8)
+	for i, pixel := range pixels {
+		if pixel {
+			packed[i/8] |= 0x80 >> uint(i%8)
+		}
+	}
+	return packed
+}
+
+// Unpack the specified number of pixels from bits
+func unpackBits(packed []byte, count uint) ([]bool, error) {
+	if uint(len(packed)) != (count+7)/8 {
+		return nil, fmt.Errorf("Bitmap has %d bytes, expected %d", len(packed), (count+7)/8)
+	}
+	pixels := make([]bool, count)
+	for i := range pixels {
+		pixels[i] = packed[i/8]&(0x80>>uint(i%8)) != 0
+	}
+	return pixels, nil
+}
+
+// Pack pixels into the lengths of alternating runs of unset and set pixels
+func packRuns(pixels []bool) []byte {
+	var packed []byte
+	buf := make([]byte, binary.MaxVarintLen64)
+	run, value := uint64(0), false
+	for _, pixel := range pixels {
+		if pixel != value {
+			packed = append(packed, buf[:binary.PutUvarint(buf, run)]...)
+			run, value = 0, pixel
+		}
+		run++
+	}
+	return append(packed, buf[:binary.PutUvarint(buf, run)]...)
+}
+
+// Unpack the specified number of pixels from the lengths of alternating runs
+func unpackRuns(packed []byte, count uint) ([]bool, error) {
+	pixels := make([]bool, 0, count)
+	value := false
+	for len(packed) > 0 {
+		run, n := binary.Uvarint(packed)
+		if n <= 0 {
+			return nil, fmt.Errorf("Bitmap has a malformed run length")
+		}
+		if run > uint64(count)-uint64(len(pixels)) {
+			return nil, fmt.Errorf("Bitmap has more than %d pixels", count)
+		}
+		for i := uint64(0); i < run; i++ {
+			pixels = append(pixels, value)
+		}
+		packed, value = packed[n:], !value
+	}
+	if uint(len(pixels)) != count {
+		return nil, fmt.Errorf("Bitmap has %d pixels, expected %d", len(pixels), count)
+	}
+	return pixels, nil
+}
@@ -0,0 +1,160 @@
+package bitmap
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/briggySmalls/flipdot/app/internal/protos"
+)
+
+func TestPack(t *testing.T) {
+	// A 3x2 image
+	data := []bool{
+		true, true, false,
+		false, false, true,
+	}
+	// Prepare test table
+	tables := []struct {
+		name        string
+		order       protos.Bitmap_Order
+		compression protos.Bitmap_Compression
+		packed      []byte
+	}{
+		{"rows", protos.Bitmap_ROW_MAJOR, protos.Bitmap_NONE, []byte{0xc4}},
+		{"columns", protos.Bitmap_COLUMN_MAJOR, protos.Bitmap_NONE, []byte{0xa4}},
+		{"row runs", protos.Bitmap_ROW_MAJOR, protos.Bitmap_RUN_LENGTH, []byte{0, 2, 3, 1}},
+		{"column runs", protos.Bitmap_COLUMN_MAJOR, protos.Bitmap_RUN_LENGTH, []byte{0, 1, 1, 1, 2, 1}},
+	}
+	for _, table := range tables {
+		b, err := Pack(data, 3, 2, table.order, table.compression)
+		failOnError(err, t)
+		if !reflect.DeepEqual(b.Data, table.packed) || b.Width != 3 || b.Height != 2 {
+			t.Errorf("Unexpected %s bitmap: %s", table.name, b.String())
+		}
+		// Check the image survives the round trip
+		unpacked, err := Unpack(b, MaxPixels)
+		failOnError(err, t)
+		if !reflect.DeepEqual(unpacked, data) {
+			t.Errorf("Unexpected %s data: %v", table.name, unpacked)
+		}
+	}
+	// Check images that don't fit are rejected
+	if _, err := Pack(data, 2, 2, protos.Bitmap_ROW_MAJOR, protos.Bitmap_NONE); err == nil {
+		t.Error("Wrongly sized image not rejected")
+	}
+}
+
+func TestLongRuns(t *testing.T) {
+	// Runs longer than a byte need several bytes to encode
+	data := make([]bool, 300)
+	data[299] = true
+	b, err := Pack(data, 30, 10, protos.Bitmap_ROW_MAJOR, protos.Bitmap_RUN_LENGTH)
+	failOnError(err, t)
+	unpacked, err := Unpack(b, MaxPixels)
+	failOnError(err, t)
+	if !reflect.DeepEqual(unpacked, data) {
+		t.Error("Long runs not unpacked")
+	}
+}
+
+func TestUnpackInvalid(t *testing.T) {
+	for name, b := range map[string]*protos.Bitmap{
+		"short":          {Width: 3, Height: 3, Data: []byte{0xff}},
+		"too many runs":  {Width: 2, Height: 2, Compression: protos.Bitmap_RUN_LENGTH, Data: []byte{3, 2}},
+		"too few runs":   {Width: 2, Height: 2, Compression: protos.Bitmap_RUN_LENGTH, Data: []byte{1, 2}},
+		"malformed run":  {Width: 2, Height: 2, Compression: protos.Bitmap_RUN_LENGTH, Data: []byte{0x80}},
+		"too many bytes": {Width: 2, Height: 2, Compression: protos.Bitmap_RUN_LENGTH, Data: []byte{0, 0, 0, 0, 0, 4}},
+		"huge":           {Width: 1 << 31, Height: 1 << 31, Compression: protos.Bitmap_RUN_LENGTH, Data: []byte{0x80, 0x80, 0x80, 0x80, 0x40}},
+		// The number of pixels wraps to zero if multiplied in 32 bits
+		"overflowing": {Width: 1 << 16, Height: 1 << 16},
+	} {
+		if _, err := Unpack(b, MaxPixels); err == nil {
+			t.Errorf("Invalid %s bitmap not rejected", name)
+		}
+	}
+}
+
+func TestUnpackLimit(t *testing.T) {
+	data := []bool{true, false, false, true}
+	b, err := Pack(data, 2, 2, protos.Bitmap_ROW_MAJOR, protos.Bitmap_RUN_LENGTH)
+	failOnError(err, t)
+	// Check images larger than the limit are rejected, however they are encoded
+	if _, err := Unpack(b, 3); err == nil {
+		t.Error("Bitmap larger than limit not rejected")
+	}
+	for _, image := range []*protos.Image{{Data: data}, {Bitmap: b}} {
+		if _, err := Pixels(image, 3); err == nil {
+			t.Error("Image larger than limit not rejected")
+		}
+		if _, err := Unpacked(image, 3); err == nil {
+			t.Error("Image larger than limit not unpacked")
+		}
+	}
+}
+
+func TestPixels(t *testing.T) {
+	data := []bool{true, false, false, true}
+	b, err := Pack(data, 2, 2, protos.Bitmap_ROW_MAJOR, protos.Bitmap_RUN_LENGTH)
+	failOnError(err, t)
+	// Check both encodings are understood
+	for _, image := range []*protos.Image{{Data: data}, {Bitmap: b}} {
+		pixels, err := Pixels(image, MaxPixels)
+		failOnError(err, t)
+		if !reflect.DeepEqual(pixels, data) {
+			t.Errorf("Unexpected pixels: %v", pixels)
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	data := []bool{
+		true, false, true,
+		false, true, false,
+	}
+	// Check images are cropped and padded from the top-left corner
+	resized := Resize(data, 3, 2, 2, 3)
+	expected := []bool{
+		true, false,
+		false, true,
+		false, false,
+	}
+	if !reflect.DeepEqual(resized, expected) {
+		t.Errorf("Unexpected resized image: %v", resized)
+	}
+}
+
+func TestRegions(t *testing.T) {
+	before := []bool{
+		true, false, false, true,
+		false, false, false, false,
+		true, false, false, true,
+	}
+	after := []bool{
+		true, false, false, true,
+		false, true, false, false,
+		true, false, true, true,
+	}
+	// Check the change is bounded tightly
+	region := Changed(before, after, 4, 3)
+	if region == nil || region.X != 1 || region.Y != 1 || region.Width != 2 || region.Height != 2 {
+		t.Fatalf("Unexpected region: %v", region)
+	}
+	if Changed(before, before, 4, 3) != nil {
+		t.Error("Region found between identical images")
+	}
+	// Check the region can be carried over to the old image
+	patch := Crop(after, 4, region)
+	if !reflect.DeepEqual(patch, []bool{true, false, false, true}) {
+		t.Errorf("Unexpected cropped region: %v", patch)
+	}
+	if !reflect.DeepEqual(Paste(before, 4, region, patch), after) {
+		t.Error("Region not pasted")
+	}
+}
+
+// Helper function to stop a test in the event of an error
+func failOnError(err error, t *testing.T) {
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -2,26 +2,54 @@ package client
 
 import (
 	context "context"
+	"errors"
 	fmt "fmt"
+	"log"
+	"sync"
 	"time"
 
+	"github.com/briggySmalls/flipdot/app/internal/bitmap"
+	"github.com/briggySmalls/flipdot/app/internal/events"
+	"github.com/briggySmalls/flipdot/app/internal/layout"
 	"github.com/briggySmalls/flipdot/app/internal/protos"
 	"github.com/briggySmalls/flipdot/app/internal/text"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const (
 	contextTimeoutS = 10
 	minDrawWaitTime = 2 * time.Second
+	minRetryBackoff = 500 * time.Millisecond
+	maxRetryBackoff = 30 * time.Second
 )
 
+// Error returned for requests made whilst the driver cannot be reached
+var ErrDriverUnavailable = errors.New("driver unavailable")
+
+// Error returned for requests the driver reports it can't handle
+var ErrUnsupported = errors.New("not supported by driver")
+
+// Capabilities assumed of drivers too old to report them
+var legacyCapabilities = []protos.GetInfoResponse_Capability{
+	protos.GetInfoResponse_LIGHT,
+	protos.GetInfoResponse_TEST,
+}
+
 type Flipdot interface {
 	Signs() []*protos.GetInfoResponse_SignInfo
-	Size() (width, height uint)
 	LightOn() error
 	LightOff() error
+	IsLightOn() bool
 	TestStart() error
 	TestStop() error
-	Draw(images []*protos.Image, isWait bool) error
+	Draw(ctx context.Context, images []*protos.Image, isWait bool) (int, error)
+	FitImages(images []*protos.Image) ([]*protos.Image, error)
+	Frame() *protos.Frame
+	Health() *protos.DriverHealth
+	Layout() layout.Layout
+	Capabilities() []protos.GetInfoResponse_Capability
+	Version() string
 }
 
 type flipdot struct {
@@ -31,16 +59,71 @@ type flipdot struct {
 	signs []*protos.GetInfoResponse_SignInfo
 	// Names of signs from GetInfo request
 	signNames []string
+	// Features and version the driver reported from GetInfo request
+	capabilities []protos.GetInfoResponse_Capability
+	version      string
+	// Where signs sit on a canvas spanning them (if configured)
+	placements []layout.Placement
+	layout     layout.Layout
+	// Changes made to images to suit how each sign is mounted
+	transforms map[string]Transform
+	// Whether bitmaps of the wrong size are cropped or padded, rather than rejected
+	fit bool
+	// Guards the signs, which are re-fetched after reconnecting
+	signsMux sync.RWMutex
 	// TextBuilder used to convert text to images
 	textBuilder text.TextBuilder
 	// Duration to space out message frames
 	frameTime time.Duration
+	// Image last drawn on each sign
+	frame map[string]*protos.Image
+	// Image that should be shown on each sign, redrawn after reconnecting
+	target   map[string]*protos.Image
+	frameMux sync.Mutex
+	// Whether the light was last turned on, and if it has been set at all
+	lightOn  bool
+	lightSet bool
+	lightMux sync.Mutex
+	// Hub notified whenever an image is drawn or the driver's health changes
+	events events.Hub
+	// Whether the driver is reachable, and if not the error that said so
+	healthy   bool
+	healthErr error
+	healthMux sync.Mutex
+	// Bounds on the time waited between attempts to reconnect
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	// Whether the driver may accept frames streamed over a single call
+	streamable bool
+	streamMux  sync.Mutex
+	// Context the client runs within, which stops attempts to reach the driver once cancelled
+	ctx context.Context
 }
 
-func NewFlipdot(client protos.DriverClient, frameTime time.Duration) (f Flipdot, err error) {
+// An image to draw on a sign
+type signImage struct {
+	sign  string
+	image protos.Image
+}
+
+// Create a flipdot controller, which draws each image across all signs if they are placed on a canvas
+//
+// Waits for the driver to become reachable, until the context is cancelled.
+func NewFlipdot(ctx context.Context, client protos.DriverClient, frameTime time.Duration, events events.Hub, placements []layout.Placement, transforms map[string]Transform, fit bool) (f Flipdot, err error) {
 	flipdot := flipdot{
-		client:    client,
-		frameTime: frameTime,
+		client:     client,
+		frameTime:  frameTime,
+		placements: placements,
+		transforms: transforms,
+		fit:        fit,
+		frame:      make(map[string]*protos.Image),
+		target:     make(map[string]*protos.Image),
+		events:     events,
+		healthy:    true,
+		minBackoff: minRetryBackoff,
+		maxBackoff: maxRetryBackoff,
+		streamable: true,
+		ctx:        ctx,
 	}
 	err = flipdot.init()
 	f = Flipdot(&flipdot)
@@ -57,6 +140,13 @@ func (f *flipdot) LightOff() (err error) {
 	return f.light(false)
 }
 
+// Report whether the light was last turned on
+func (f *flipdot) IsLightOn() bool {
+	f.lightMux.Lock()
+	defer f.lightMux.Unlock()
+	return f.lightOn
+}
+
 // Send request to start the test sequence
 func (f *flipdot) TestStart() (err error) {
 	return f.test(true)
@@ -69,25 +159,35 @@ func (f *flipdot) TestStop() (err error) {
 
 // Get info from the sign
 func (f *flipdot) Signs() (signs []*protos.GetInfoResponse_SignInfo) {
+	f.signsMux.RLock()
+	defer f.signsMux.RUnlock()
 	return f.signs
 }
 
-// Return accepted size for flipdot
-func (f *flipdot) Size() (width, height uint) {
-	// Get the first sign
-	sign := f.Signs()[0]
-	// Return the sign's dimensions
-	return uint(sign.Width), uint(sign.Height)
-}
-
-// Draw a set of images
-func (f *flipdot) Draw(images []*protos.Image, isWait bool) (err error) {
+// Draw a set of images, returning how many were drawn before finishing or being cancelled
+func (f *flipdot) Draw(ctx context.Context, images []*protos.Image, isWait bool) (drawn int, err error) {
+	// Don't start drawing if we've already been cancelled
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	total := len(images)
+	// Check the images will fit the signs, and work with their data whichever way they were encoded
+	images, err = f.FitImages(images)
+	if err != nil {
+		return
+	}
+	// Stream the frames if the driver supports it
+	stream := f.openStream(ctx, total)
+	if stream != nil {
+		defer stream.close()
+	}
 	// Send any relevant images
-	images, err = f.sendFrame(images)
+	images, err = f.sendFrame(ctx, images, stream)
 	if err != nil {
 		// We've errored
-		return
+		return drawn, drawError(ctx, err)
 	}
+	drawn = total - len(images)
 	// Create a ticker for sending frames
 	var ticker *time.Ticker
 	if !isWait && len(images) == 0 {
@@ -101,65 +201,357 @@ func (f *flipdot) Draw(images []*protos.Image, isWait bool) (err error) {
 	// Write images periodically
 	for {
 		select {
+		case <-ctx.Done():
+			// We've been asked to stop
+			return drawn, ctx.Err()
 		case <-ticker.C:
 			if len(images) > 0 {
 				// Send a frame's-worth of images
-				images, err = f.sendFrame(images)
+				images, err = f.sendFrame(ctx, images, stream)
 				if err != nil {
-					return
+					return drawn, drawError(ctx, err)
 				}
+				drawn = total - len(images)
 			} else {
 				// We've finished displaying images, move on
 				return
 			}
 		}
 	}
+}
+
+// Check images are the size they will be drawn at, returning their data
+func (f *flipdot) FitImages(images []*protos.Image) (fitted []*protos.Image, err error) {
+	signs := f.Signs()
+	l := f.Layout()
+	for i, image := range images {
+		// Find the size the image will be drawn at
+		var width, height uint
+		if l != nil {
+			width, height = l.Size()
+		} else {
+			sign := signs[i%len(signs)]
+			width, height = uint(sign.Width), uint(sign.Height)
+		}
+		// Don't unpack more than the sign can show, unless we've been asked to crop it
+		max := uint64(width) * uint64(height)
+		if f.fit && max < bitmap.MaxPixels {
+			max = bitmap.MaxPixels
+		}
+		var data []bool
+		data, err = bitmap.Pixels(image, max)
+		if err != nil {
+			return nil, fmt.Errorf("Image %d is invalid: %s", i, err)
+		}
+		if b := image.GetBitmap(); b != nil && (uint(b.Width) != width || uint(b.Height) != height) {
+			if !f.fit {
+				return nil, fmt.Errorf("Image %d is %dx%d, expected %dx%d", i, b.Width, b.Height, width, height)
+			}
+			// The bitmap says which pixels to crop or pad
+			data = bitmap.Resize(data, uint(b.Width), uint(b.Height), width, height)
+		} else if uint(len(data)) != width*height {
+			return nil, fmt.Errorf("Image %d has %d pixels, expected %dx%d", i, len(data), width, height)
+		}
+		fitted = append(fitted, &protos.Image{Data: data})
+	}
 	return
 }
 
-// Initialise the struct with some one-off attributes
+// Get the images last drawn on the signs
+func (f *flipdot) Frame() *protos.Frame {
+	f.frameMux.Lock()
+	defer f.frameMux.Unlock()
+	frame := protos.Frame{}
+	for _, sign := range f.getSignNames() {
+		if image, ok := f.frame[sign]; ok {
+			frame.Signs = append(frame.Signs, &protos.Frame_SignImage{Sign: sign, Image: image})
+		}
+	}
+	return &frame
+}
+
+// Report whether the driver is currently reachable
+func (f *flipdot) Health() *protos.DriverHealth {
+	f.healthMux.Lock()
+	defer f.healthMux.Unlock()
+	health := protos.DriverHealth{Healthy: f.healthy}
+	if f.healthErr != nil {
+		health.Error = f.healthErr.Error()
+	}
+	return &health
+}
+
+// Initialise the struct with some one-off attributes, waiting for the driver if it isn't up yet
 func (f *flipdot) init() (err error) {
-	// Get the signs for later
-	f.signs, err = f.getSigns()
-	if err != nil {
-		return
+	backoff := f.minBackoff
+	for {
+		// Get the signs for later
+		var info *protos.GetInfoResponse
+		info, err = f.getInfo()
+		if err == nil {
+			return f.setInfo(info)
+		} else if !IsUnreachable(err) {
+			return
+		}
+		log.Printf("Waiting for driver: %s", err)
+		backoff, err = f.backOff(backoff)
+		if err != nil {
+			return
+		}
 	}
+}
+
+// Record the signs and capabilities reported by the driver
+func (f *flipdot) setInfo(info *protos.GetInfoResponse) (err error) {
+	signs := info.Signs
 	// Validate the signs
-	err = checkSigns(f.signs)
+	err = checkSigns(signs)
 	if err != nil {
 		return
 	}
+	// Check the transformed signs exist
+	for name := range f.transforms {
+		if findSign(signs, name) == nil {
+			return fmt.Errorf("Transform configured for unknown sign: %s", name)
+		}
+	}
+	// Place the signs on the canvas, if they span one
+	var l layout.Layout
+	if len(f.placements) > 0 {
+		l, err = layout.NewLayout(f.placements, signs)
+		if err != nil {
+			return
+		}
+	}
 	// Get the sign names
 	var signNames []string
-	for _, sign := range f.signs {
+	for _, sign := range signs {
 		signNames = append(signNames, sign.Name)
 	}
+	// Older drivers don't say what they can do
+	capabilities := info.Capabilities
+	if len(capabilities) == 0 {
+		capabilities = legacyCapabilities
+	}
+	f.signsMux.Lock()
+	f.signs = signs
 	f.signNames = signNames
+	f.layout = l
+	f.capabilities = capabilities
+	f.version = info.Version
+	f.signsMux.Unlock()
+	// Only try streaming if the driver may support it
+	f.setStreamable(len(info.Capabilities) == 0 || f.hasCapability(protos.GetInfoResponse_STREAM))
+	// Signs turned over by both the driver and us would end up upside down again
+	if f.hasCapability(protos.GetInfoResponse_FLIP) {
+		for sign, transform := range f.transforms {
+			if transform.Rotate180 {
+				log.Printf("Warning: sign %s is rotated, but the driver can flip signs too (only configure one)", sign)
+			}
+		}
+	}
+	return
+}
+
+// Get the features the driver supports
+func (f *flipdot) Capabilities() []protos.GetInfoResponse_Capability {
+	f.signsMux.RLock()
+	defer f.signsMux.RUnlock()
+	return f.capabilities
+}
+
+// Get the version the driver reported
+func (f *flipdot) Version() string {
+	f.signsMux.RLock()
+	defer f.signsMux.RUnlock()
+	return f.version
+}
+
+// Check if the driver supports a feature
+func (f *flipdot) hasCapability(capability protos.GetInfoResponse_Capability) bool {
+	for _, supported := range f.Capabilities() {
+		if supported == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// Get the canvas spanning the signs (nil if each image is drawn on a single sign)
+func (f *flipdot) Layout() layout.Layout {
+	f.signsMux.RLock()
+	defer f.signsMux.RUnlock()
+	return f.layout
+}
+
+// Get the names of the signs, in the order the driver reported them
+func (f *flipdot) getSignNames() []string {
+	f.signsMux.RLock()
+	defer f.signsMux.RUnlock()
+	return f.signNames
+}
+
+// Send a request to the driver, noticing if the driver has become unreachable
+func (f *flipdot) call(parent context.Context, request func(ctx context.Context) error) (err error) {
+	// Don't bother the driver whilst we are waiting for it to come back
+	if !f.Health().Healthy {
+		return ErrDriverUnavailable
+	}
+	// Send the request
+	ctx, cancel := getContext(parent)
+	defer cancel()
+	err = request(ctx)
+	if parent.Err() == nil && IsUnreachable(err) {
+		// Only blame the driver if the caller didn't give up first
+		f.disconnected(err)
+	}
 	return
 }
 
+// Mark the driver as unreachable, and start trying to reconnect
+func (f *flipdot) disconnected(err error) {
+	f.healthMux.Lock()
+	if !f.healthy {
+		// We are already trying to reconnect
+		f.healthMux.Unlock()
+		return
+	}
+	f.healthy = false
+	f.healthErr = err
+	f.healthMux.Unlock()
+	log.Printf("Lost connection to driver: %s", err)
+	f.publishHealth()
+	go f.reconnect()
+}
+
+// Poll the driver, backing off between attempts, until it is reachable again (or we shut down)
+func (f *flipdot) reconnect() {
+	backoff := f.minBackoff
+	for {
+		var err error
+		backoff, err = f.backOff(backoff)
+		if err != nil {
+			return
+		}
+		err = f.restore()
+		if err == nil {
+			return
+		}
+		f.healthMux.Lock()
+		f.healthErr = err
+		f.healthMux.Unlock()
+	}
+}
+
+// Wait before trying to reach the driver again, getting a longer wait for the attempt after
+func (f *flipdot) backOff(backoff time.Duration) (next time.Duration, err error) {
+	select {
+	case <-time.After(backoff):
+	case <-f.ctx.Done():
+		return backoff, f.ctx.Err()
+	}
+	next = backoff * 2
+	if next > f.maxBackoff {
+		next = f.maxBackoff
+	}
+	return
+}
+
+// Re-fetch the signs and redraw what they should show, marking the driver as healthy
+func (f *flipdot) restore() (err error) {
+	// Check the driver is back, and whether the signs or its capabilities have changed
+	info, err := f.getInfo()
+	if err != nil {
+		return
+	}
+	err = f.setInfo(info)
+	if err != nil {
+		return
+	}
+	// Redraw the last frame, as the driver may have restarted with blank signs
+	f.frameMux.Lock()
+	target := make(map[string]*protos.Image, len(f.target))
+	for sign, image := range f.target {
+		target[sign] = image
+	}
+	f.frameMux.Unlock()
+	for _, sign := range f.getSignNames() {
+		if image, ok := target[sign]; ok {
+			err = f.sendImage(*image, sign)
+			if err != nil {
+				return
+			}
+		}
+	}
+	// Set the light as it was, as the driver may have restarted with it off
+	f.lightMux.Lock()
+	lightOn, lightSet := f.lightOn, f.lightSet
+	f.lightMux.Unlock()
+	if lightSet && f.hasCapability(protos.GetInfoResponse_LIGHT) {
+		err = f.sendLight(lightOn)
+		if err != nil {
+			return
+		}
+	}
+	// We are healthy again
+	f.healthMux.Lock()
+	f.healthy = true
+	f.healthErr = nil
+	f.healthMux.Unlock()
+	log.Println("Reconnected to driver")
+	f.publishHealth()
+	return
+}
+
+// Notify subscribers of the driver's health
+func (f *flipdot) publishHealth() {
+	f.events.Publish(&protos.Event{Payload: &protos.Event_DriverHealth{DriverHealth: f.Health()}})
+}
+
 // Send request to set the light status
 func (f *flipdot) light(on bool) (err error) {
-	// Get context
-	ctx, cancel := getContext()
-	defer cancel()
-	// Send request
-	var status protos.LightRequest_Status
-	if on {
-		status = protos.LightRequest_ON
-	} else {
-		status = protos.LightRequest_OFF
+	// Don't bother drivers without a light
+	if !f.hasCapability(protos.GetInfoResponse_LIGHT) {
+		return ErrUnsupported
 	}
-	_, err = f.client.Light(ctx, &protos.LightRequest{Status: status})
+	// Send request
+	err = f.call(context.Background(), func(ctx context.Context) (err error) {
+		_, err = f.client.Light(ctx, lightRequest(on))
+		return
+	})
 	// Handle errors
+	if err != nil {
+		return
+	}
+	// Record the new status
+	f.lightMux.Lock()
+	f.lightOn = on
+	f.lightSet = true
+	f.lightMux.Unlock()
+	return
+}
+
+// Set the light whilst reconnecting
+func (f *flipdot) sendLight(on bool) (err error) {
+	ctx, cancel := getContext(f.ctx)
+	defer cancel()
+	_, err = f.client.Light(ctx, lightRequest(on))
 	return
 }
 
+// Create a request to set the light status
+func lightRequest(on bool) *protos.LightRequest {
+	if on {
+		return &protos.LightRequest{Status: protos.LightRequest_ON}
+	}
+	return &protos.LightRequest{Status: protos.LightRequest_OFF}
+}
+
 // Send request to start/stop test sequence
 func (f *flipdot) test(start bool) (err error) {
-	// Get context
-	ctx, cancel := getContext()
-	defer cancel()
+	if !f.hasCapability(protos.GetInfoResponse_TEST) {
+		return ErrUnsupported
+	}
 	// Send request
 	var action protos.TestRequest_Action
 	if start {
@@ -167,76 +559,300 @@ func (f *flipdot) test(start bool) (err error) {
 	} else {
 		action = protos.TestRequest_STOP
 	}
-	_, err = f.client.Test(ctx, &protos.TestRequest{Action: action})
+	err = f.call(context.Background(), func(ctx context.Context) (err error) {
+		_, err = f.client.Test(ctx, &protos.TestRequest{Action: action})
+		return
+	})
+	// The test pattern changes the dots, so forget what the signs showed
+	f.frameMux.Lock()
+	f.frame = make(map[string]*protos.Image)
+	f.frameMux.Unlock()
 	return
 }
 
 // Send a set of images to available signs
-func (f *flipdot) sendFrame(images []*protos.Image) (leftover []*protos.Image, err error) {
+func (f *flipdot) sendFrame(ctx context.Context, images []*protos.Image, stream *drawStream) (leftover []*protos.Image, err error) {
+	var frame []signImage
+	if l := f.Layout(); l != nil {
+		frame, leftover, err = canvasFrame(l, f.getSignNames(), images)
+		if err != nil {
+			return
+		}
+	} else {
+		frame, leftover = f.signsFrame(images)
+	}
+	err = f.writeFrame(ctx, frame, stream)
+	return
+}
+
+// Take an image for each sign in turn
+func (f *flipdot) signsFrame(images []*protos.Image) (frame []signImage, leftover []*protos.Image) {
 	leftover = images
-	width, height := f.Size()
-	blankImageData := make([]bool, width*height)
-	for _, sign := range f.signNames {
+	for _, sign := range f.Signs() {
 		// Send an empty image if there are none left (removes old messages)
 		if len(leftover) == 0 {
-			f.writeImage(protos.Image{Data: blankImageData}, sign)
+			frame = append(frame, signImage{sign: sign.Name, image: protos.Image{Data: make([]bool, sign.Width*sign.Height)}})
 			return
 		}
-		// Pop an image off the stack and send it
+		// Pop an image off the stack
 		var image *protos.Image
 		image, leftover = leftover[0], leftover[1:]
-		err = f.writeImage(*image, sign)
+		frame = append(frame, signImage{sign: sign.Name, image: *image})
+	}
+	return
+}
+
+// Take the next image, spread across the signs on the canvas
+func canvasFrame(l layout.Layout, signs []string, images []*protos.Image) (frame []signImage, leftover []*protos.Image, err error) {
+	if len(images) == 0 {
+		return
+	}
+	// Cut the image up for each sign
+	signImages, err := l.Slice(images[0])
+	if err != nil {
+		return
+	}
+	for _, sign := range signs {
+		if image, ok := signImages[sign]; ok {
+			frame = append(frame, signImage{sign: sign, image: *image})
+		}
+	}
+	return frame, images[1:], nil
+}
+
+// Write a frame of images to the signs, remembering they should be shown there
+func (f *flipdot) writeFrame(ctx context.Context, frame []signImage, stream *drawStream) (err error) {
+	// Save flipping the dots of signs that already show their image
+	var changed []signImage
+	shown := make(map[string]*protos.Image)
+	f.frameMux.Lock()
+	for _, next := range frame {
+		image := next.image
+		f.target[next.sign] = &image
+		if last, ok := f.frame[next.sign]; !ok || !isSameImage(last, &image) {
+			changed = append(changed, next)
+			shown[next.sign] = last
+		}
+	}
+	f.frameMux.Unlock()
+	if len(changed) == 0 {
+		return
+	}
+	// Send the whole frame at once, if we can
+	if stream != nil && stream.err == nil && f.isStreamable() {
+		err = f.call(ctx, func(_ context.Context) error {
+			return f.streamImages(stream, changed, shown)
+		})
+		switch status.Code(err) {
+		case codes.Unimplemented:
+			log.Println("Driver doesn't support streaming, drawing images individually")
+			f.setStreamable(false)
+		case codes.FailedPrecondition:
+			// The driver doesn't know what the signs show, so draw the whole of each
+			log.Println("Driver can't draw regions of signs, redrawing images individually")
+			shown = make(map[string]*protos.Image)
+		default:
+			return
+		}
+	}
+	for _, next := range changed {
+		next := next
+		err = f.call(ctx, func(ctx context.Context) error {
+			return f.drawImage(ctx, next.image, next.sign, shown[next.sign])
+		})
 		if err != nil {
 			return
 		}
 	}
-	return leftover, nil
+	return
 }
 
-// Write an image to the specified sign
-func (f *flipdot) writeImage(image protos.Image, sign string) (err error) {
-	// Send request
-	ctx, cancel := getContext()
+// Write an image to the specified sign whilst reconnecting
+func (f *flipdot) sendImage(image protos.Image, sign string) (err error) {
+	ctx, cancel := getContext(f.ctx)
 	defer cancel()
-	_, err = f.client.Draw(ctx, &protos.DrawRequest{
-		Sign:  sign,
-		Image: &image,
-	})
+	return f.drawImage(ctx, image, sign, nil)
+}
+
+// Send a request to draw an image over the one shown (if known), recording it as drawn if successful
+func (f *flipdot) drawImage(ctx context.Context, image protos.Image, sign string, shown *protos.Image) (err error) {
+	_, err = f.client.Draw(ctx, f.drawRequest(image, sign, shown))
+	if shown != nil && status.Code(err) == codes.FailedPrecondition {
+		// The driver doesn't know what the sign shows, so draw the whole of it
+		_, err = f.client.Draw(ctx, f.drawRequest(image, sign, nil))
+	}
+	if err != nil {
+		return
+	}
+	f.recordFrame([]signImage{{sign: sign, image: image}})
 	return
 }
 
-// Check that all signs have the same width/height
-func checkSigns(signs []*protos.GetInfoResponse_SignInfo) error {
-	var width, height uint32
-	for i, sign := range signs {
-		if i == 0 {
-			width = sign.Width
-			height = sign.Height
-		} else {
-			if width != sign.Width {
-				return fmt.Errorf("Sign width %d != %d", sign.Width, width)
-			} else if height != sign.Height {
-				return fmt.Errorf("Sign height %d != %d", sign.Height, height)
+// Send a frame of images over a stream, recording them as drawn if successful
+func (f *flipdot) streamImages(stream *drawStream, images []signImage, shown map[string]*protos.Image) (err error) {
+	var requests []*protos.DrawRequest
+	for _, next := range images {
+		requests = append(requests, f.drawRequest(next.image, next.sign, shown[next.sign]))
+	}
+	err = stream.draw(requests)
+	if err != nil {
+		return
+	}
+	f.recordFrame(images)
+	return
+}
+
+// Create a request to draw an image, adjusted to suit how the sign is mounted
+//
+// If the driver accepts regions, only the part that differs from the image
+// shown (if known) is sent.
+func (f *flipdot) drawRequest(image protos.Image, sign string, shown *protos.Image) *protos.DrawRequest {
+	info := findSign(f.Signs(), sign)
+	if info == nil {
+		// Leave the driver to reject images for unknown signs
+		return &protos.DrawRequest{Sign: sign, Image: &image}
+	}
+	width, height := uint(info.Width), uint(info.Height)
+	request := &protos.DrawRequest{Sign: sign, Image: f.transformed(image, sign, width, height)}
+	// Only send the dots that changed to drivers that accept regions
+	if shown != nil && f.hasCapability(protos.GetInfoResponse_PARTIAL) {
+		before := f.transformed(*shown, sign, width, height)
+		if uint(len(before.Data)) == width*height && uint(len(request.Image.Data)) == width*height {
+			region := bitmap.Changed(before.Data, request.Image.Data, width, height)
+			if region != nil && (uint(region.Width) < width || uint(region.Height) < height) {
+				request.Image = &protos.Image{Data: bitmap.Crop(request.Image.Data, width, region)}
+				request.Region = region
+				width, height = uint(region.Width), uint(region.Height)
 			}
 		}
 	}
+	// Save bandwidth with drivers that understand bitmaps
+	if f.hasCapability(protos.GetInfoResponse_BITMAP) {
+		if packed, err := bitmap.Packed(request.Image, width, height); err == nil {
+			request.Image = packed
+		}
+	}
+	return request
+}
+
+// Get an image adjusted to suit how the specified sign is mounted
+func (f *flipdot) transformed(image protos.Image, sign string, width, height uint) *protos.Image {
+	if transform, ok := f.transforms[sign]; ok {
+		image = transform.Apply(image, width, height)
+	}
+	return &image
+}
+
+// Record what the signs now show, and notify subscribers
+func (f *flipdot) recordFrame(images []signImage) {
+	f.frameMux.Lock()
+	for _, next := range images {
+		image := next.image
+		f.frame[next.sign] = &image
+	}
+	f.frameMux.Unlock()
+	f.events.Publish(&protos.Event{Payload: &protos.Event_FrameDrawn{FrameDrawn: f.Frame()}})
+}
+
+// Open a stream for drawing the specified number of frames (nil if frames can't be streamed)
+func (f *flipdot) openStream(parent context.Context, frames int) *drawStream {
+	if !f.isStreamable() || !f.Health().Healthy {
+		return nil
+	}
+	// Allow time for every frame to be shown
+	ctx, cancel := context.WithTimeout(parent, contextTimeoutS*time.Second+time.Duration(frames)*f.frameTime)
+	stream, err := f.client.DrawStream(ctx)
+	if err != nil {
+		cancel()
+		if status.Code(err) == codes.Unimplemented {
+			log.Println("Driver doesn't support streaming, drawing images individually")
+			f.setStreamable(false)
+		}
+		// Leave drawing images individually to find out if the driver has gone away
+		return nil
+	}
+	return &drawStream{stream: stream, cancel: cancel, hold: f.frameTime}
+}
+
+// Report whether the driver may accept streamed frames
+func (f *flipdot) isStreamable() bool {
+	f.streamMux.Lock()
+	defer f.streamMux.Unlock()
+	return f.streamable
+}
+
+// Record whether the driver may accept streamed frames
+func (f *flipdot) setStreamable(streamable bool) {
+	f.streamMux.Lock()
+	f.streamable = streamable
+	f.streamMux.Unlock()
+}
+
+// Check if two images would show the same dots
+func isSameImage(a, b *protos.Image) bool {
+	if len(a.Data) != len(b.Data) {
+		return false
+	}
+	for i := range a.Data {
+		if a.Data[i] != b.Data[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Check that there are signs to draw on, each with some dots
+func checkSigns(signs []*protos.GetInfoResponse_SignInfo) error {
+	if len(signs) == 0 {
+		return fmt.Errorf("No signs available")
+	}
+	for _, sign := range signs {
+		if sign.Width == 0 || sign.Height == 0 {
+			return fmt.Errorf("Sign %s has no dots (%dx%d)", sign.Name, sign.Width, sign.Height)
+		}
+	}
+	return nil
+}
+
+// Get the information for the sign with the specified name (nil if not present)
+func findSign(signs []*protos.GetInfoResponse_SignInfo, name string) *protos.GetInfoResponse_SignInfo {
+	for _, sign := range signs {
+		if sign.Name == name {
+			return sign
+		}
+	}
 	return nil
 }
 
 // Request signs information from service
-func (f *flipdot) getSigns() (signs []*protos.GetInfoResponse_SignInfo, err error) {
-	// Get the signs
-	context, cancel := getContext()
+func (f *flipdot) getInfo() (info *protos.GetInfoResponse, err error) {
+	ctx, cancel := getContext(f.ctx)
 	defer cancel()
-	response, err := f.client.GetInfo(context, &protos.GetInfoRequest{})
-	if err != nil {
-		// Something went wrong
-		return nil, err
+	return f.client.GetInfo(ctx, &protos.GetInfoRequest{})
+}
+
+// Check if an error indicates the driver could not be reached, so the request may succeed later
+func IsUnreachable(err error) bool {
+	if err == ErrDriverUnavailable {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
+
+// Report the reason drawing stopped early, preferring cancellation by the caller
+func drawError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
-	return response.Signs, nil
+	return err
 }
 
-// Get a simple context for sending requests via gRPC
-func getContext() (context.Context, context.CancelFunc) {
-	return context.WithTimeout(context.Background(), contextTimeoutS*time.Second)
+// Get a context for sending a single request via gRPC
+func getContext(parent context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(parent, contextTimeoutS*time.Second)
 }
@@ -1,15 +1,21 @@
 package client
 
 import (
+	"context"
 	"fmt"
 	reflect "reflect"
 	"testing"
 	"time"
 
+	"github.com/briggySmalls/flipdot/app/internal/bitmap"
+	"github.com/briggySmalls/flipdot/app/internal/events"
+	"github.com/briggySmalls/flipdot/app/internal/layout"
 	"github.com/briggySmalls/flipdot/app/internal/protos"
 	"github.com/golang/mock/gomock"
 	"golang.org/x/image/font"
 	"golang.org/x/image/font/inconsolata"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const (
@@ -73,10 +79,47 @@ func TestCreate(t *testing.T) {
 	response := getStandardSignsResponse()
 	mock.EXPECT().GetInfo(gomock.Any(), gomock.Any()).Return(&response, nil)
 	// Create the flipdot instance
-	_, err := NewFlipdot(mock, frameDuration)
+	_, err := NewFlipdot(context.Background(), mock, frameDuration, events.NewHub(1), nil, nil, false)
 	failOnError(err, t)
 }
 
+// Test creating a client before the driver is up
+func TestCreateWaitsForDriver(t *testing.T) {
+	ctrl, mock := createMock(t)
+	defer ctrl.Finish()
+	// Expect the driver to be polled until it is reachable
+	response := getStandardSignsResponse()
+	gomock.InOrder(
+		mock.EXPECT().GetInfo(gomock.Any(), gomock.Any()).Return(nil, status.Error(codes.Unavailable, "connection refused")),
+		mock.EXPECT().GetInfo(gomock.Any(), gomock.Any()).Return(&response, nil),
+	)
+	f, err := NewFlipdot(context.Background(), mock, frameDuration, events.NewHub(1), nil, nil, false)
+	failOnError(err, t)
+	if len(f.Signs()) != 2 {
+		t.Errorf("Unexpected signs: %v", f.Signs())
+	}
+}
+
+// Test giving up waiting for the driver
+func TestCreateCancelled(t *testing.T) {
+	ctrl, mock := createMock(t)
+	defer ctrl.Finish()
+	// Configure a driver that never comes up
+	mock.EXPECT().GetInfo(gomock.Any(), gomock.Any()).Return(nil, status.Error(codes.Unavailable, "connection refused")).AnyTimes()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := NewFlipdot(ctx, mock, frameDuration, events.NewHub(1), nil, nil, false); err != context.DeadlineExceeded {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	// Check errors other than the driver being unreachable aren't retried
+	ctrl, mock = createMock(t)
+	defer ctrl.Finish()
+	mock.EXPECT().GetInfo(gomock.Any(), gomock.Any()).Return(nil, status.Error(codes.Internal, "broken"))
+	if _, err := NewFlipdot(context.Background(), mock, frameDuration, events.NewHub(1), nil, nil, false); status.Code(err) != codes.Internal {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
 // Test sending the start test call
 func TestTestStart(t *testing.T) {
 	ctrl, mock := createMock(t)
@@ -124,7 +167,11 @@ func TestLightsOn(t *testing.T) {
 	)
 	// Run the test
 	runTest(func(f Flipdot) error {
-		return f.LightOn()
+		err := f.LightOn()
+		if !f.IsLightOn() {
+			t.Error("Light not reported as on")
+		}
+		return err
 	}, mock, t)
 }
 
@@ -141,28 +188,54 @@ func TestLightsOff(t *testing.T) {
 	)
 	// Run the test
 	runTest(func(f Flipdot) error {
-		return f.LightOff()
+		err := f.LightOff()
+		if f.IsLightOn() {
+			t.Error("Light not reported as off")
+		}
+		return err
 	}, mock, t)
 }
 
 // Test initialising with a client with incompatible signs
-func TestDifferentSignsCaught(t *testing.T) {
+func TestEmptySignsCaught(t *testing.T) {
 	ctrl, mock := createMock(t)
 	defer ctrl.Finish()
-	// Construct signs with different dimensions
+	// Construct a sign without any dots
 	sign_a := protos.GetInfoResponse_SignInfo{Name: "a", Width: 1, Height: 1}
-	sign_b := protos.GetInfoResponse_SignInfo{Name: "b", Width: 1, Height: 2}
+	sign_b := protos.GetInfoResponse_SignInfo{Name: "b", Width: 1, Height: 0}
 	info_response := protos.GetInfoResponse{Signs: []*protos.GetInfoResponse_SignInfo{&sign_a, &sign_b}}
 	// Configure the mock
 	mock.EXPECT().GetInfo(gomock.Any(), gomock.Any()).Return(&info_response, nil)
 	// Create a new flipdot
-	_, err := NewFlipdot(mock, frameDuration)
+	_, err := NewFlipdot(context.Background(), mock, frameDuration, events.NewHub(1), nil, nil, false)
 	// Confirm there was an error
 	if err == nil {
-		t.Errorf("Incompatible signs not detected")
+		t.Errorf("Unusable signs not detected")
 	}
 }
 
+func TestDrawDifferentSizes(t *testing.T) {
+	ctrl, mock := createMock(t)
+	defer ctrl.Finish()
+	// Construct signs with different dimensions
+	small := protos.GetInfoResponse_SignInfo{Name: "small", Width: 84, Height: 7}
+	large := protos.GetInfoResponse_SignInfo{Name: "large", Width: 96, Height: 16}
+	infoResponse := protos.GetInfoResponse{Signs: []*protos.GetInfoResponse_SignInfo{&small, &large}}
+	smallImageData := make([]bool, small.Width*small.Height)
+	smallImageData[0] = true
+	// Expect the unused sign to be blanked with an image of its own size
+	drawResponse := protos.DrawResponse{}
+	gomock.InOrder(
+		mock.EXPECT().GetInfo(gomock.Any(), gomock.Any()).Return(&infoResponse, nil),
+		expectNoStream(mock),
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("small", smallImageData)).Return(&drawResponse, nil),
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("large", make([]bool, large.Width*large.Height))).Return(&drawResponse, nil),
+	)
+	f, err := NewFlipdot(context.Background(), mock, frameDuration, events.NewHub(1), nil, nil, false)
+	failOnError(err, t)
+	failOnError(draw(f, []*protos.Image{{Data: smallImageData}}, true), t)
+}
+
 func TestDraw(t *testing.T) {
 	ctrl, mock := createMock(t)
 	defer ctrl.Finish()
@@ -178,9 +251,10 @@ func TestDraw(t *testing.T) {
 	// Expect the mock images
 	gomock.InOrder(
 		mock.EXPECT().GetInfo(gomock.Any(), gomock.Any()).Return(&infoResponse, nil),
+		expectNoStream(mock),
 		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("top", topImageData)).Return(&drawResponse, nil),
 		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("bottom", bottomImageData)).Return(&drawResponse, nil),
-		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("top", topImageData)).Return(&drawResponse, nil),
+		// Top sign already shows the next image, so it is not redrawn
 		// Final image is false because it is an 'empty' end-of-frame
 		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("bottom", falseImageData)).Return(&drawResponse, nil),
 	)
@@ -192,10 +266,529 @@ func TestDraw(t *testing.T) {
 	}
 	// Run the test
 	runTest(func(f Flipdot) error {
-		return f.Draw(images, false)
+		return draw(f, images, false)
 	}, mock, t)
 }
 
+func TestFrame(t *testing.T) {
+	ctrl, mock := createMock(t)
+	defer ctrl.Finish()
+	// Configure the mock
+	drawResponse := protos.DrawResponse{}
+	infoResponse := getStandardSignsResponse()
+	imageData := make([]bool, infoResponse.Signs[0].Width*infoResponse.Signs[0].Height)
+	imageData[0] = true
+	gomock.InOrder(
+		mock.EXPECT().GetInfo(gomock.Any(), gomock.Any()).Return(&infoResponse, nil),
+		expectNoStream(mock),
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("top", imageData)).Return(&drawResponse, nil),
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("bottom", nil)).Return(&drawResponse, nil),
+	)
+	// Create a flipdot, and listen for frame updates
+	hub := events.NewHub(2)
+	updates, unsubscribe := hub.Subscribe()
+	defer unsubscribe()
+	f, err := NewFlipdot(context.Background(), mock, frameDuration, hub, nil, nil, false)
+	failOnError(err, t)
+	// Check nothing has been drawn yet
+	if len(f.Frame().Signs) != 0 {
+		t.Fatal("Frame not initially empty")
+	}
+	// Draw an image
+	failOnError(draw(f, []*protos.Image{{Data: imageData}}, false), t)
+	// Check the frame reflects the images drawn
+	frame := f.Frame()
+	if len(frame.Signs) != 2 || frame.Signs[0].Sign != "top" || frame.Signs[1].Sign != "bottom" {
+		t.Fatalf("Unexpected frame: %s", frame.String())
+	}
+	if !reflect.DeepEqual(frame.Signs[0].Image.Data, imageData) {
+		t.Error("Unexpected image in frame")
+	}
+	// Check an update was published for each image drawn
+	for i := 1; i <= 2; i++ {
+		event := <-updates
+		if len(event.GetFrameDrawn().GetSigns()) != i {
+			t.Errorf("Unexpected frame update: %s", event.String())
+		}
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	ctrl, mock := createMock(t)
+	defer ctrl.Finish()
+	// Configure the mock
+	drawResponse := protos.DrawResponse{}
+	infoResponse := getStandardSignsResponse()
+	unavailable := status.Error(codes.Unavailable, "connection refused")
+	firstImageData := make([]bool, infoResponse.Signs[0].Width*infoResponse.Signs[0].Height)
+	firstImageData[0] = true
+	secondImageData := make([]bool, infoResponse.Signs[0].Width*infoResponse.Signs[0].Height)
+	secondImageData[1] = true
+	gomock.InOrder(
+		mock.EXPECT().GetInfo(gomock.Any(), gomock.Any()).Return(&infoResponse, nil),
+		mock.EXPECT().Light(gomock.Any(), RequestLightStatus(protos.LightRequest_ON)).Return(&protos.LightResponse{}, nil),
+		expectNoStream(mock),
+		// The driver goes away
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("top", firstImageData)).Return(nil, unavailable),
+		// The driver is polled until it comes back
+		mock.EXPECT().GetInfo(gomock.Any(), gomock.Any()).Return(nil, unavailable),
+		mock.EXPECT().GetInfo(gomock.Any(), gomock.Any()).Return(&infoResponse, nil),
+		// The frame that should be shown is redrawn, and the light set as it was
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("top", secondImageData)).Return(&drawResponse, nil),
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("bottom", nil)).Return(&drawResponse, nil),
+		mock.EXPECT().Light(gomock.Any(), RequestLightStatus(protos.LightRequest_ON)).Return(&protos.LightResponse{}, nil),
+	)
+	// Create a flipdot, and listen for health updates
+	hub := events.NewHub(4)
+	updates, unsubscribe := hub.Subscribe()
+	defer unsubscribe()
+	f, err := NewFlipdot(context.Background(), mock, frameDuration, hub, nil, nil, false)
+	failOnError(err, t)
+	f.(*flipdot).minBackoff = 50 * time.Millisecond
+	failOnError(f.LightOn(), t)
+	// Check the driver error is returned, and the driver is marked unhealthy
+	err = draw(f, []*protos.Image{{Data: firstImageData}}, false)
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if f.Health().Healthy {
+		t.Error("Driver not reported as unhealthy")
+	}
+	// Check requests are refused whilst the driver is away
+	err = draw(f, []*protos.Image{{Data: secondImageData}}, false)
+	if err != ErrDriverUnavailable {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Check the driver is reported healthy once it is back
+	for _, healthy := range []bool{false, true} {
+		health := waitForHealth(updates, t)
+		if health.Healthy != healthy {
+			t.Fatalf("Unexpected health: %s", health.String())
+		}
+	}
+	if !f.Health().Healthy {
+		t.Error("Driver not reported as healthy")
+	}
+	// Check the frame was restored
+	if !reflect.DeepEqual(f.Frame().Signs[0].Image.Data, secondImageData) {
+		t.Error("Frame not restored")
+	}
+}
+
+// Test reconnecting stops when the client shuts down
+func TestReconnectCancelled(t *testing.T) {
+	ctrl, mock := createMock(t)
+	defer ctrl.Finish()
+	// Expect the driver to go away, and not to be polled once shut down
+	infoResponse := getStandardSignsResponse()
+	imageData := make([]bool, infoResponse.Signs[0].Width*infoResponse.Signs[0].Height)
+	gomock.InOrder(
+		mock.EXPECT().GetInfo(gomock.Any(), gomock.Any()).Return(&infoResponse, nil),
+		expectNoStream(mock),
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("top", imageData)).Return(nil, status.Error(codes.Unavailable, "connection refused")),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	f, err := NewFlipdot(ctx, mock, frameDuration, events.NewHub(1), nil, nil, false)
+	failOnError(err, t)
+	f.(*flipdot).minBackoff = 50 * time.Millisecond
+	if err = draw(f, []*protos.Image{{Data: imageData}}, false); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Shut down, and give the client a chance to (wrongly) poll the driver
+	cancel()
+	time.Sleep(200 * time.Millisecond)
+}
+
+func TestDrawUnchanged(t *testing.T) {
+	ctrl, mock := createMock(t)
+	defer ctrl.Finish()
+	// Configure the mock
+	drawResponse := protos.DrawResponse{}
+	infoResponse := getStandardSignsResponse()
+	firstImageData := make([]bool, infoResponse.Signs[0].Width*infoResponse.Signs[0].Height)
+	firstImageData[0] = true
+	secondImageData := make([]bool, infoResponse.Signs[0].Width*infoResponse.Signs[0].Height)
+	secondImageData[1] = true
+	// Expect only the images that changed to be sent
+	gomock.InOrder(
+		mock.EXPECT().GetInfo(gomock.Any(), gomock.Any()).Return(&infoResponse, nil),
+		expectNoStream(mock),
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("top", firstImageData)).Return(&drawResponse, nil),
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("bottom", firstImageData)).Return(&drawResponse, nil),
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("bottom", secondImageData)).Return(&drawResponse, nil),
+	)
+	// Draw the same frame twice, then change one sign
+	f, err := NewFlipdot(context.Background(), mock, frameDuration, events.NewHub(1), nil, nil, false)
+	failOnError(err, t)
+	for _, images := range [][]*protos.Image{
+		{{Data: firstImageData}, {Data: firstImageData}},
+		{{Data: firstImageData}, {Data: firstImageData}},
+		{{Data: firstImageData}, {Data: secondImageData}},
+	} {
+		failOnError(draw(f, images, true), t)
+	}
+}
+
+func TestDrawAfterTest(t *testing.T) {
+	ctrl, mock := createMock(t)
+	defer ctrl.Finish()
+	// Configure a driver that can draw regions of signs
+	drawResponse := protos.DrawResponse{}
+	testResponse := protos.TestResponse{}
+	infoResponse := getStandardSignsResponse()
+	infoResponse.Capabilities = []protos.GetInfoResponse_Capability{protos.GetInfoResponse_TEST, protos.GetInfoResponse_PARTIAL}
+	imageData := make([]bool, infoResponse.Signs[0].Width*infoResponse.Signs[0].Height)
+	imageData[0] = true
+	// Expect the same frame to be redrawn in full once the test pattern has been shown
+	gomock.InOrder(
+		mock.EXPECT().GetInfo(gomock.Any(), gomock.Any()).Return(&infoResponse, nil),
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("top", imageData)).Return(&drawResponse, nil),
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("bottom", imageData)).Return(&drawResponse, nil),
+		mock.EXPECT().Test(gomock.Any(), RequestTestAction(protos.TestRequest_START)).Return(&testResponse, nil),
+		mock.EXPECT().Test(gomock.Any(), RequestTestAction(protos.TestRequest_STOP)).Return(&testResponse, nil),
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("top", imageData)).Return(&drawResponse, nil),
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("bottom", imageData)).Return(&drawResponse, nil),
+	)
+	f, err := NewFlipdot(context.Background(), mock, frameDuration, events.NewHub(1), nil, nil, false)
+	failOnError(err, t)
+	images := []*protos.Image{{Data: imageData}, {Data: imageData}}
+	failOnError(draw(f, images, true), t)
+	failOnError(f.TestStart(), t)
+	failOnError(f.TestStop(), t)
+	failOnError(draw(f, images, true), t)
+}
+
+func TestDrawCanvas(t *testing.T) {
+	ctrl, mock := createMock(t)
+	defer ctrl.Finish()
+	// Construct a pair of signs stacked on a canvas
+	top := protos.GetInfoResponse_SignInfo{Name: "top", Width: 2, Height: 1}
+	bottom := protos.GetInfoResponse_SignInfo{Name: "bottom", Width: 2, Height: 1}
+	infoResponse := protos.GetInfoResponse{Signs: []*protos.GetInfoResponse_SignInfo{&top, &bottom}}
+	placements := []layout.Placement{{Sign: "top"}, {Sign: "bottom", Y: 1}}
+	// Expect each canvas image to be split across the signs
+	drawResponse := protos.DrawResponse{}
+	gomock.InOrder(
+		mock.EXPECT().GetInfo(gomock.Any(), gomock.Any()).Return(&infoResponse, nil),
+		expectNoStream(mock),
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("top", []bool{true, false})).Return(&drawResponse, nil),
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("bottom", []bool{false, true})).Return(&drawResponse, nil),
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("top", []bool{false, false})).Return(&drawResponse, nil),
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("bottom", []bool{true, true})).Return(&drawResponse, nil),
+	)
+	f, err := NewFlipdot(context.Background(), mock, frameDuration, events.NewHub(1), placements, nil, false)
+	failOnError(err, t)
+	// Check the canvas covers both signs
+	if width, height := f.Layout().Size(); width != 2 || height != 2 {
+		t.Fatalf("Unexpected canvas size: %dx%d", width, height)
+	}
+	// Draw a couple of canvas images
+	failOnError(draw(f, []*protos.Image{
+		{Data: []bool{true, false, false, true}},
+		{Data: []bool{false, false, true, true}},
+	}, true), t)
+	// Check images that don't fit the canvas are rejected
+	if draw(f, []*protos.Image{{Data: []bool{true}}}, true) == nil {
+		t.Error("Wrongly sized image not rejected")
+	}
+}
+
+func TestDrawTransformed(t *testing.T) {
+	ctrl, mock := createMock(t)
+	defer ctrl.Finish()
+	// Construct a sign mounted upside-down
+	top := protos.GetInfoResponse_SignInfo{Name: "top", Width: 2, Height: 1}
+	infoResponse := protos.GetInfoResponse{Signs: []*protos.GetInfoResponse_SignInfo{&top}}
+	transforms := map[string]Transform{"top": {Rotate180: true}}
+	// Expect the image to be turned before it is sent
+	gomock.InOrder(
+		mock.EXPECT().GetInfo(gomock.Any(), gomock.Any()).Return(&infoResponse, nil),
+		expectNoStream(mock),
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("top", []bool{false, true})).Return(&protos.DrawResponse{}, nil),
+	)
+	f, err := NewFlipdot(context.Background(), mock, frameDuration, events.NewHub(1), nil, transforms, false)
+	failOnError(err, t)
+	failOnError(draw(f, []*protos.Image{{Data: []bool{true, false}}}, true), t)
+	// Check the frame reports the image as it appears
+	if !reflect.DeepEqual(f.Frame().Signs[0].Image.Data, []bool{true, false}) {
+		t.Errorf("Unexpected frame: %s", f.Frame().String())
+	}
+	// Check transforms for unknown signs are rejected
+	mock.EXPECT().GetInfo(gomock.Any(), gomock.Any()).Return(&infoResponse, nil)
+	_, err = NewFlipdot(context.Background(), mock, frameDuration, events.NewHub(1), nil, map[string]Transform{"bottom": {Invert: true}}, false)
+	if err == nil {
+		t.Error("Transform for unknown sign not rejected")
+	}
+}
+
+func TestDrawPacked(t *testing.T) {
+	ctrl, mock := createMock(t)
+	defer ctrl.Finish()
+	// Construct a small sign
+	top := protos.GetInfoResponse_SignInfo{Name: "top", Width: 2, Height: 2}
+	infoResponse := protos.GetInfoResponse{Signs: []*protos.GetInfoResponse_SignInfo{&top}}
+	data := []bool{true, false, true, true}
+	packed, err := bitmap.Pack(data, 2, 2, protos.Bitmap_ROW_MAJOR, protos.Bitmap_RUN_LENGTH)
+	failOnError(err, t)
+	// Expect the bitmap to be sent as image data
+	gomock.InOrder(
+		mock.EXPECT().GetInfo(gomock.Any(), gomock.Any()).Return(&infoResponse, nil),
+		expectNoStream(mock),
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("top", data)).Return(&protos.DrawResponse{}, nil),
+	)
+	f, err := NewFlipdot(context.Background(), mock, frameDuration, events.NewHub(1), nil, nil, false)
+	failOnError(err, t)
+	failOnError(draw(f, []*protos.Image{{Bitmap: packed}}, true), t)
+	// Check malformed bitmaps are rejected
+	packed.Width = 3
+	if draw(f, []*protos.Image{{Bitmap: packed}}, true) == nil {
+		t.Error("Malformed bitmap not rejected")
+	}
+}
+
+func TestFitImages(t *testing.T) {
+	ctrl, mock := createMock(t)
+	defer ctrl.Finish()
+	// Construct signs of different sizes
+	top := protos.GetInfoResponse_SignInfo{Name: "top", Width: 2, Height: 1}
+	bottom := protos.GetInfoResponse_SignInfo{Name: "bottom", Width: 3, Height: 1}
+	infoResponse := protos.GetInfoResponse{Signs: []*protos.GetInfoResponse_SignInfo{&top, &bottom}}
+	mock.EXPECT().GetInfo(gomock.Any(), gomock.Any()).Return(&infoResponse, nil).Times(2)
+	strict, err := NewFlipdot(context.Background(), mock, frameDuration, events.NewHub(1), nil, nil, false)
+	failOnError(err, t)
+	fitting, err := NewFlipdot(context.Background(), mock, frameDuration, events.NewHub(1), nil, nil, true)
+	failOnError(err, t)
+	// Check images are matched against the signs they will be drawn on
+	wide := &protos.Bitmap{Width: 3, Height: 1, Data: []byte{0xa0}}
+	images := []*protos.Image{{Bitmap: wide}, {Bitmap: wide}, {Data: []bool{true, true}}}
+	if _, err := strict.FitImages(images); err == nil {
+		t.Error("Wrongly sized bitmap not rejected")
+	}
+	fitted, err := fitting.FitImages(images)
+	failOnError(err, t)
+	for i, expected := range [][]bool{{true, false}, {true, false, true}, {true, true}} {
+		if !reflect.DeepEqual(fitted[i].Data, expected) {
+			t.Errorf("Unexpected image %d: %v", i, fitted[i].Data)
+		}
+	}
+	// Check huge bitmaps are rejected, even when fitting them
+	huge := &protos.Bitmap{Width: 1 << 31, Height: 1 << 31, Compression: protos.Bitmap_RUN_LENGTH, Data: []byte{0}}
+	if _, err := fitting.FitImages([]*protos.Image{{Bitmap: huge}}); err == nil {
+		t.Error("Huge bitmap not rejected")
+	}
+	// Check image data of the wrong size is always rejected, as it can't be cropped
+	for _, f := range []Flipdot{strict, fitting} {
+		if _, err := f.FitImages([]*protos.Image{{Data: []bool{true}}}); err == nil {
+			t.Error("Wrongly sized image not rejected")
+		}
+	}
+}
+
+func TestDrawCancelled(t *testing.T) {
+	ctrl, mock := createMock(t)
+	defer ctrl.Finish()
+	// Configure the mock
+	drawResponse := protos.DrawResponse{}
+	infoResponse := getStandardSignsResponse()
+	imageData := make([]bool, infoResponse.Signs[0].Width*infoResponse.Signs[0].Height)
+	imageData[0] = true
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Expect only the first frame to be drawn, before we give up
+	gomock.InOrder(
+		mock.EXPECT().GetInfo(gomock.Any(), gomock.Any()).Return(&infoResponse, nil),
+		expectNoStream(mock),
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("top", nil)).Return(&drawResponse, nil),
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("bottom", nil)).Do(func(interface{}, interface{}, ...interface{}) {
+			cancel()
+		}).Return(&drawResponse, nil),
+	)
+	// Create a flipdot that waits a long time between frames
+	f, err := NewFlipdot(context.Background(), mock, time.Hour, events.NewHub(1), nil, nil, false)
+	failOnError(err, t)
+	// Check drawing stops promptly, reporting how far it got
+	drawn, err := f.Draw(ctx, []*protos.Image{{Data: imageData}, {Data: imageData}, {Data: imageData}, {Data: imageData}}, true)
+	if err != context.Canceled {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if drawn != 2 {
+		t.Errorf("Unexpected number of images drawn: %d", drawn)
+	}
+	// Check the driver isn't blamed
+	if !f.Health().Healthy {
+		t.Error("Driver reported unhealthy after cancellation")
+	}
+}
+
+func TestDrawStreamed(t *testing.T) {
+	ctrl, mock := createMock(t)
+	defer ctrl.Finish()
+	stream := protos.NewMockDriver_DrawStreamClient(ctrl)
+	// Configure the mock
+	infoResponse := getStandardSignsResponse()
+	var images []*protos.Image
+	for i := 0; i < 3; i++ {
+		imageData := make([]bool, infoResponse.Signs[0].Width*infoResponse.Signs[0].Height)
+		imageData[i] = true
+		images = append(images, &protos.Image{Data: imageData})
+	}
+	var sent []*protos.DrawFrame
+	recordFrame := func(frame *protos.DrawFrame) {
+		sent = append(sent, frame)
+	}
+	// Expect each frame to be sent across both signs, and acknowledged
+	gomock.InOrder(
+		mock.EXPECT().GetInfo(gomock.Any(), gomock.Any()).Return(&infoResponse, nil),
+		mock.EXPECT().DrawStream(gomock.Any()).Return(stream, nil),
+		stream.EXPECT().Send(gomock.Any()).Do(recordFrame),
+		stream.EXPECT().Recv().Return(&protos.DrawFrameResponse{Sequence: 1}, nil),
+		stream.EXPECT().Send(gomock.Any()).Do(recordFrame),
+		stream.EXPECT().Recv().Return(&protos.DrawFrameResponse{Sequence: 2}, nil),
+		stream.EXPECT().CloseSend(),
+	)
+	f, err := NewFlipdot(context.Background(), mock, frameDuration, events.NewHub(1), nil, nil, false)
+	failOnError(err, t)
+	failOnError(draw(f, images, true), t)
+	// Check the frames were numbered, and carried images for each sign that changed
+	if len(sent) != 2 {
+		t.Fatalf("Unexpected number of frames: %d", len(sent))
+	}
+	for i, frame := range sent {
+		if frame.Sequence != uint64(i+1) || len(frame.Images) != 2 || frame.Hold == nil {
+			t.Errorf("Unexpected frame: %s", frame.String())
+		}
+	}
+	if sent[1].Images[0].Sign != "top" || sent[1].Images[1].Sign != "bottom" {
+		t.Errorf("Unexpected frame: %s", sent[1].String())
+	}
+	// Check the frame reports the last images drawn
+	if frame := f.Frame(); !reflect.DeepEqual(frame.Signs[0].Image, images[2]) || frame.Signs[1].Image.Data[1] {
+		t.Errorf("Unexpected frame: %s", frame.String())
+	}
+}
+
+func TestDrawStreamUnsupported(t *testing.T) {
+	ctrl, mock := createMock(t)
+	defer ctrl.Finish()
+	stream := protos.NewMockDriver_DrawStreamClient(ctrl)
+	// Configure the mock
+	drawResponse := protos.DrawResponse{}
+	infoResponse := getStandardSignsResponse()
+	// Expect the driver to reject the stream once it is used, and images to be drawn individually instead
+	gomock.InOrder(
+		mock.EXPECT().GetInfo(gomock.Any(), gomock.Any()).Return(&infoResponse, nil),
+		mock.EXPECT().DrawStream(gomock.Any()).Return(stream, nil),
+		stream.EXPECT().Send(gomock.Any()),
+		stream.EXPECT().Recv().Return(nil, status.Error(codes.Unimplemented, "unknown method DrawStream")),
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("top", nil)).Return(&drawResponse, nil),
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("bottom", nil)).Return(&drawResponse, nil),
+		stream.EXPECT().CloseSend(),
+	)
+	f, err := NewFlipdot(context.Background(), mock, frameDuration, events.NewHub(1), nil, nil, false)
+	failOnError(err, t)
+	imageData := make([]bool, infoResponse.Signs[0].Width*infoResponse.Signs[0].Height)
+	imageData[0] = true
+	failOnError(draw(f, []*protos.Image{{Data: imageData}}, true), t)
+	// Check the driver isn't asked to stream again
+	mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("top", nil)).Return(&drawResponse, nil)
+	failOnError(draw(f, []*protos.Image{{Data: make([]bool, len(imageData))}}, true), t)
+}
+
+func TestCapabilities(t *testing.T) {
+	ctrl, mock := createMock(t)
+	defer ctrl.Finish()
+	// Configure a driver that only understands bitmaps and the test sequence
+	infoResponse := getStandardSignsResponse()
+	infoResponse.Capabilities = []protos.GetInfoResponse_Capability{protos.GetInfoResponse_TEST, protos.GetInfoResponse_BITMAP}
+	infoResponse.Version = "1.2.3"
+	var sent *protos.DrawRequest
+	// Expect images to be sent packed to both signs, without trying to stream
+	gomock.InOrder(
+		mock.EXPECT().GetInfo(gomock.Any(), gomock.Any()).Return(&infoResponse, nil),
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("top", nil)).Do(func(_ context.Context, request *protos.DrawRequest, _ ...interface{}) {
+			sent = request
+		}).Return(&protos.DrawResponse{}, nil),
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("bottom", nil)).Return(&protos.DrawResponse{}, nil),
+	)
+	f, err := NewFlipdot(context.Background(), mock, frameDuration, events.NewHub(1), nil, nil, false)
+	failOnError(err, t)
+	if f.Version() != "1.2.3" || len(f.Capabilities()) != 2 {
+		t.Errorf("Unexpected driver info: %s %v", f.Version(), f.Capabilities())
+	}
+	imageData := make([]bool, infoResponse.Signs[0].Width*infoResponse.Signs[0].Height)
+	imageData[0] = true
+	failOnError(draw(f, []*protos.Image{{Data: imageData}}, true), t)
+	if sent.Image.GetBitmap() == nil {
+		t.Fatal("Image not sent as a bitmap")
+	}
+	pixels, err := bitmap.Pixels(sent.Image, bitmap.MaxPixels)
+	failOnError(err, t)
+	if !reflect.DeepEqual(pixels, imageData) {
+		t.Errorf("Unexpected image sent: %v", pixels)
+	}
+	// Check the missing light isn't requested
+	if err := f.LightOn(); err != ErrUnsupported {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestLegacyCapabilities(t *testing.T) {
+	ctrl, mock := createMock(t)
+	defer ctrl.Finish()
+	// Check drivers that report nothing are assumed to have a light and test sequence
+	infoResponse := getStandardSignsResponse()
+	mock.EXPECT().GetInfo(gomock.Any(), gomock.Any()).Return(&infoResponse, nil)
+	f, err := NewFlipdot(context.Background(), mock, frameDuration, events.NewHub(1), nil, nil, false)
+	failOnError(err, t)
+	if !reflect.DeepEqual(f.Capabilities(), legacyCapabilities) {
+		t.Errorf("Unexpected capabilities: %v", f.Capabilities())
+	}
+}
+
+func TestDrawPartial(t *testing.T) {
+	ctrl, mock := createMock(t)
+	defer ctrl.Finish()
+	// Configure a driver that can draw regions of signs
+	drawResponse := protos.DrawResponse{}
+	infoResponse := getStandardSignsResponse()
+	infoResponse.Capabilities = []protos.GetInfoResponse_Capability{protos.GetInfoResponse_PARTIAL}
+	width := infoResponse.Signs[0].Width
+	blank := make([]bool, width*infoResponse.Signs[0].Height)
+	first := append([]bool{}, blank...)
+	first[0] = true
+	second := append([]bool{}, first...)
+	second[width+2], second[2*width+3] = true, true
+	third := append([]bool{}, second...)
+	third[0] = false
+	var sent []*protos.DrawRequest
+	recordRequest := func(_ context.Context, request *protos.DrawRequest, _ ...interface{}) {
+		sent = append(sent, request)
+	}
+	// Expect whole images at first, then only what changed
+	gomock.InOrder(
+		mock.EXPECT().GetInfo(gomock.Any(), gomock.Any()).Return(&infoResponse, nil),
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("top", first)).Return(&drawResponse, nil),
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("bottom", blank)).Return(&drawResponse, nil),
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("top", []bool{true, false, false, true})).Do(recordRequest).Return(&drawResponse, nil),
+		// Expect a driver that has lost track of the sign to be sent all of it
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("top", []bool{false})).Return(nil, status.Error(codes.FailedPrecondition, "No image drawn")),
+		mock.EXPECT().Draw(gomock.Any(), RequestDrawImage("top", third)).Return(&drawResponse, nil),
+	)
+	f, err := NewFlipdot(context.Background(), mock, frameDuration, events.NewHub(1), nil, nil, false)
+	failOnError(err, t)
+	for _, image := range [][]bool{first, second, third} {
+		failOnError(draw(f, []*protos.Image{{Data: image}}, true), t)
+	}
+	// Check the region covered the changed dots
+	region := sent[0].Region
+	if region == nil || region.X != 2 || region.Y != 1 || region.Width != 2 || region.Height != 2 {
+		t.Errorf("Unexpected region: %v", region)
+	}
+	if !reflect.DeepEqual(f.Frame().Signs[0].Image.Data, third) {
+		t.Error("Whole image not recorded as drawn")
+	}
+}
+
 // Helper function to create a mock FlipdotClient
 func createMock(t *testing.T) (*gomock.Controller, *protos.MockDriverClient) {
 	// Create a mock
@@ -204,16 +797,41 @@ func createMock(t *testing.T) (*gomock.Controller, *protos.MockDriverClient) {
 	return ctrl, mock
 }
 
+// Helper function to expect a driver that can't stream frames
+func expectNoStream(mock *protos.MockDriverClient) *gomock.Call {
+	return mock.EXPECT().DrawStream(gomock.Any()).Return(nil, status.Error(codes.Unimplemented, "unknown method DrawStream"))
+}
+
 // Helper function to create a Flipdot and run a test function
 func runTest(fn func(f Flipdot) error, mock *protos.MockDriverClient, t *testing.T) {
 	// Create a flipdot
-	f, err := NewFlipdot(mock, frameDuration)
+	f, err := NewFlipdot(context.Background(), mock, frameDuration, events.NewHub(1), nil, nil, false)
 	failOnError(err, t)
 	// Run the command
 	err = fn(f)
 	failOnError(err, t)
 }
 
+// Helper function to wait for the next driver health event, ignoring others
+func waitForHealth(updates <-chan *protos.Event, t *testing.T) *protos.DriverHealth {
+	for {
+		select {
+		case event := <-updates:
+			if health := event.GetDriverHealth(); health != nil {
+				return health
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for driver health")
+		}
+	}
+}
+
+// Helper function to draw images until finished, ignoring how many were drawn
+func draw(f Flipdot, images []*protos.Image, isWait bool) error {
+	_, err := f.Draw(context.Background(), images, isWait)
+	return err
+}
+
 // Helper function to get a font face
 func getFont() (font font.Face) {
 	return inconsolata.Regular8x16
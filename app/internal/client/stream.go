@@ -0,0 +1,59 @@
+package client
+
+import (
+	context "context"
+	fmt "fmt"
+	"io"
+	"time"
+
+	"github.com/briggySmalls/flipdot/app/internal/protos"
+	"github.com/golang/protobuf/ptypes"
+)
+
+// Frames sent to the driver over a single streaming call
+type drawStream struct {
+	stream protos.Driver_DrawStreamClient
+	cancel context.CancelFunc
+	// Number of the last frame sent
+	sequence uint64
+	// Time each frame is expected to be shown for
+	hold time.Duration
+	// Error that ended the stream, so no more frames can be sent
+	err error
+}
+
+// Send a frame of images, waiting for the driver to draw it
+func (s *drawStream) draw(requests []*protos.DrawRequest) (err error) {
+	defer func() {
+		if err != nil {
+			s.err = err
+		}
+	}()
+	s.sequence++
+	err = s.stream.Send(&protos.DrawFrame{
+		Sequence: s.sequence,
+		Images:   requests,
+		Hold:     ptypes.DurationProto(s.hold),
+	})
+	if err == io.EOF {
+		// The driver ended the stream, the reason is given when receiving
+		_, err = s.stream.Recv()
+	}
+	if err != nil {
+		return
+	}
+	response, err := s.stream.Recv()
+	if err != nil {
+		return
+	}
+	if response.Sequence != s.sequence {
+		return fmt.Errorf("Driver acknowledged frame %d, expected %d", response.Sequence, s.sequence)
+	}
+	return
+}
+
+// Tell the driver there are no more frames
+func (s *drawStream) close() {
+	s.stream.CloseSend()
+	s.cancel()
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"github.com/briggySmalls/flipdot/app/internal/protos"
+)
+
+// Changes made to images before they are sent to a sign, to suit how it is mounted
+type Transform struct {
+	// Turn the image upside-down
+	Rotate180 bool
+	// Swap the left and right of the image
+	MirrorHorizontal bool
+	// Swap the top and bottom of the image
+	MirrorVertical bool
+	// Swap set and unset dots
+	Invert bool
+}
+
+// Apply the transform to an image of the specified dimensions
+func (t Transform) Apply(image protos.Image, width, height uint) protos.Image {
+	// A half turn is the same as mirroring both ways
+	flipX := t.MirrorHorizontal != t.Rotate180
+	flipY := t.MirrorVertical != t.Rotate180
+	if !flipX && !flipY && !t.Invert {
+		return image
+	}
+	if uint(len(image.Data)) != width*height {
+		// Leave the driver to reject images that don't fit the sign
+		return image
+	}
+	data := make([]bool, len(image.Data))
+	for r := uint(0); r < height; r++ {
+		for c := uint(0); c < width; c++ {
+			srcR, srcC := r, c
+			if flipX {
+				srcC = width - 1 - c
+			}
+			if flipY {
+				srcR = height - 1 - r
+			}
+			data[r*width+c] = image.Data[srcR*width+srcC] != t.Invert
+		}
+	}
+	return protos.Image{Data: data}
+}
@@ -0,0 +1,50 @@
+package client
+
+import (
+	reflect "reflect"
+	"testing"
+
+	"github.com/briggySmalls/flipdot/app/internal/protos"
+)
+
+func TestTransform(t *testing.T) {
+	// A 3x2 image with a distinct dot in each corner
+	input := []bool{
+		true, false, false,
+		false, false, true,
+	}
+	// Prepare test table
+	tables := []struct {
+		name      string
+		transform Transform
+		output    []bool
+	}{
+		{"none", Transform{}, input},
+		{"rotate", Transform{Rotate180: true}, []bool{true, false, false, false, false, true}},
+		{"horizontal", Transform{MirrorHorizontal: true}, []bool{false, false, true, true, false, false}},
+		{"vertical", Transform{MirrorVertical: true}, []bool{false, false, true, true, false, false}},
+		{"both", Transform{MirrorHorizontal: true, MirrorVertical: true}, []bool{true, false, false, false, false, true}},
+		{"rotate and mirror", Transform{Rotate180: true, MirrorHorizontal: true}, []bool{false, false, true, true, false, false}},
+		{"invert", Transform{Invert: true}, []bool{false, true, true, true, true, false}},
+	}
+	for _, table := range tables {
+		output := table.transform.Apply(protos.Image{Data: input}, 3, 2)
+		if !reflect.DeepEqual(output.Data, table.output) {
+			t.Errorf("Unexpected %s output: %v", table.name, output.Data)
+		}
+	}
+}
+
+func TestTransformAsymmetric(t *testing.T) {
+	// A 2x2 image with a single dot, to tell rotations and mirrors apart
+	input := protos.Image{Data: []bool{true, false, false, false}}
+	if output := (Transform{Rotate180: true}).Apply(input, 2, 2); !reflect.DeepEqual(output.Data, []bool{false, false, false, true}) {
+		t.Errorf("Unexpected rotated output: %v", output.Data)
+	}
+	if output := (Transform{MirrorHorizontal: true}).Apply(input, 2, 2); !reflect.DeepEqual(output.Data, []bool{false, true, false, false}) {
+		t.Errorf("Unexpected mirrored output: %v", output.Data)
+	}
+	if output := (Transform{MirrorVertical: true}).Apply(input, 2, 2); !reflect.DeepEqual(output.Data, []bool{false, false, true, false}) {
+		t.Errorf("Unexpected mirrored output: %v", output.Data)
+	}
+}
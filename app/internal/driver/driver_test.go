@@ -0,0 +1,195 @@
+package driver
+
+import (
+	"context"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	reflect "reflect"
+	"testing"
+
+	"github.com/briggySmalls/flipdot/app/internal/bitmap"
+	"github.com/briggySmalls/flipdot/app/internal/protos"
+	"github.com/golang/mock/gomock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestServerMemory(t *testing.T) {
+	backend := NewMemoryDriver(getTestSigns())
+	server := NewServer(backend)
+	// Check the signs are reported
+	info, err := server.GetInfo(context.Background(), &protos.GetInfoRequest{})
+	failOnError(err, t)
+	if !reflect.DeepEqual(info.Signs, getTestSigns()) {
+		t.Errorf("Unexpected signs: %s", info.String())
+	}
+	// Check the server adds what it handles to what the backend supports
+	expected := []protos.GetInfoResponse_Capability{
+		protos.GetInfoResponse_LIGHT,
+		protos.GetInfoResponse_TEST,
+		protos.GetInfoResponse_STREAM,
+		protos.GetInfoResponse_BITMAP,
+		protos.GetInfoResponse_PARTIAL,
+	}
+	if !reflect.DeepEqual(info.Capabilities, expected) || info.Version != "memory" {
+		t.Errorf("Unexpected capabilities: %s", info.String())
+	}
+	// Draw an image, and check it is recorded
+	image := &protos.Image{Data: []bool{true, false, false, false, false, true}}
+	_, err = server.Draw(context.Background(), &protos.DrawRequest{Sign: "top", Image: image})
+	failOnError(err, t)
+	if !reflect.DeepEqual(backend.Image("top"), image) || backend.Image("bottom") != nil {
+		t.Error("Image not recorded")
+	}
+	// Draw a packed image, and check it is recorded as data
+	packed, err := bitmap.Pack(image.Data, 3, 2, protos.Bitmap_COLUMN_MAJOR, protos.Bitmap_NONE)
+	failOnError(err, t)
+	_, err = server.Draw(context.Background(), &protos.DrawRequest{Sign: "bottom", Image: &protos.Image{Bitmap: packed}})
+	failOnError(err, t)
+	if !reflect.DeepEqual(backend.Image("bottom"), image) {
+		t.Error("Packed image not recorded")
+	}
+	// Check the light and test sequence are recorded
+	_, err = server.Light(context.Background(), &protos.LightRequest{Status: protos.LightRequest_ON})
+	failOnError(err, t)
+	_, err = server.Test(context.Background(), &protos.TestRequest{Action: protos.TestRequest_START})
+	failOnError(err, t)
+	if !backend.IsLightOn() || !backend.IsTesting() {
+		t.Error("Light and test sequence not recorded")
+	}
+}
+
+func TestDrawInvalid(t *testing.T) {
+	server := NewServer(NewMemoryDriver(getTestSigns()))
+	// Check unknown signs are rejected
+	_, err := server.Draw(context.Background(), &protos.DrawRequest{Sign: "middle", Image: &protos.Image{Data: make([]bool, 6)}})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	// Check images of the wrong size are rejected
+	_, err = server.Draw(context.Background(), &protos.DrawRequest{Sign: "top", Image: &protos.Image{Data: make([]bool, 5)}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	// Check malformed bitmaps are rejected
+	_, err = server.Draw(context.Background(), &protos.DrawRequest{Sign: "top", Image: &protos.Image{Bitmap: &protos.Bitmap{Width: 3, Height: 2}}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	// Check huge bitmaps are rejected before they are unpacked
+	huge := &protos.Bitmap{Width: 1 << 31, Height: 1 << 31, Compression: protos.Bitmap_RUN_LENGTH, Data: []byte{0}}
+	_, err = server.Draw(context.Background(), &protos.DrawRequest{Sign: "top", Image: &protos.Image{Bitmap: huge}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestServerRegion(t *testing.T) {
+	backend := NewMemoryDriver(getTestSigns())
+	server := NewServer(backend)
+	region := &protos.Region{X: 1, Y: 0, Width: 2, Height: 1}
+	patch := &protos.Image{Data: []bool{true, true}}
+	// Check regions aren't drawn before the rest of the sign is known
+	_, err := server.Draw(context.Background(), &protos.DrawRequest{Sign: "top", Image: patch, Region: region})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	// Draw a region over a whole image, and check the backend is given the result
+	_, err = server.Draw(context.Background(), &protos.DrawRequest{Sign: "top", Image: &protos.Image{Data: []bool{true, false, false, false, false, true}}})
+	failOnError(err, t)
+	_, err = server.Draw(context.Background(), &protos.DrawRequest{Sign: "top", Image: patch, Region: region})
+	failOnError(err, t)
+	expected := []bool{true, true, true, false, false, true}
+	if !reflect.DeepEqual(backend.Image("top").Data, expected) {
+		t.Errorf("Unexpected image: %v", backend.Image("top").Data)
+	}
+	// Check regions off the sign, or that the image doesn't cover, are rejected
+	for _, request := range []*protos.DrawRequest{
+		{Sign: "top", Image: patch, Region: &protos.Region{X: 2, Y: 0, Width: 2, Height: 1}},
+		{Sign: "top", Image: &protos.Image{Data: []bool{true}}, Region: region},
+	} {
+		if _, err := server.Draw(context.Background(), request); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+}
+
+func TestServerStream(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	backend := NewMemoryDriver(getTestSigns())
+	server := NewServer(backend)
+	stream := protos.NewMockDriver_DrawStreamServer(ctrl)
+	// Expect a frame across both signs to be drawn and acknowledged
+	top := &protos.Image{Data: []bool{true, false, false, false, false, true}}
+	bottom := &protos.Image{Data: []bool{false, true, false, true, false, false}}
+	gomock.InOrder(
+		stream.EXPECT().Recv().Return(&protos.DrawFrame{Sequence: 1, Images: []*protos.DrawRequest{
+			{Sign: "top", Image: top},
+			{Sign: "bottom", Image: bottom},
+		}}, nil),
+		stream.EXPECT().Context().Return(context.Background()).AnyTimes(),
+		stream.EXPECT().Send(&protos.DrawFrameResponse{Sequence: 1}),
+		stream.EXPECT().Recv().Return(nil, io.EOF),
+	)
+	failOnError(server.DrawStream(stream), t)
+	if !reflect.DeepEqual(backend.Image("top"), top) || !reflect.DeepEqual(backend.Image("bottom"), bottom) {
+		t.Error("Frame not drawn")
+	}
+	// Check frames sent out of order are rejected
+	gomock.InOrder(
+		stream.EXPECT().Recv().Return(&protos.DrawFrame{Sequence: 2}, nil),
+		stream.EXPECT().Send(&protos.DrawFrameResponse{Sequence: 2}),
+		stream.EXPECT().Recv().Return(&protos.DrawFrame{Sequence: 2}, nil),
+	)
+	if err := server.DrawStream(stream); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestPng(t *testing.T) {
+	dir, err := ioutil.TempDir("", "driver")
+	failOnError(err, t)
+	defer os.RemoveAll(dir)
+	server := NewServer(NewPngDriver(getTestSigns(), dir, 2))
+	// Draw an image
+	image := &protos.Image{Data: []bool{true, false, false, false, false, true}}
+	_, err = server.Draw(context.Background(), &protos.DrawRequest{Sign: "bottom", Image: image})
+	failOnError(err, t)
+	// Check the image was written, at scale
+	file, err := os.Open(filepath.Join(dir, "bottom.png"))
+	failOnError(err, t)
+	defer file.Close()
+	written, err := png.Decode(file)
+	failOnError(err, t)
+	if size := written.Bounds().Size(); size.X != 6 || size.Y != 4 {
+		t.Fatalf("Unexpected image size: %s", size)
+	}
+	for _, pixel := range []struct {
+		x, y  int
+		isSet bool
+	}{{0, 0, true}, {1, 1, true}, {2, 0, false}, {5, 3, true}, {0, 3, false}} {
+		r, _, _, _ := written.At(pixel.x, pixel.y).RGBA()
+		if (r != 0) != pixel.isSet {
+			t.Errorf("Unexpected pixel at %d,%d", pixel.x, pixel.y)
+		}
+	}
+}
+
+// Helper function to get the configuration of some small signs
+func getTestSigns() []*protos.GetInfoResponse_SignInfo {
+	return []*protos.GetInfoResponse_SignInfo{
+		{Name: "top", Width: 3, Height: 2},
+		{Name: "bottom", Width: 3, Height: 2},
+	}
+}
+
+// Helper function to stop a test in the event of an error
+func failOnError(err error, t *testing.T) {
+	if err != nil {
+		t.Fatal(err)
+	}
+}
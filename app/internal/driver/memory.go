@@ -0,0 +1,147 @@
+package driver
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/briggySmalls/flipdot/app/internal/protos"
+	grpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Driver that keeps the state of its signs in memory
+type MemoryDriver interface {
+	protos.DriverClient
+	Image(sign string) *protos.Image
+	IsLightOn() bool
+	IsTesting() bool
+}
+
+type memoryDriver struct {
+	signs []*protos.GetInfoResponse_SignInfo
+	// Image last drawn on each sign
+	images    map[string]*protos.Image
+	isLightOn bool
+	isTesting bool
+	mux       sync.Mutex
+}
+
+// Creates a driver that records what is drawn on the specified signs, without any hardware
+func NewMemoryDriver(signs []*protos.GetInfoResponse_SignInfo) MemoryDriver {
+	return &memoryDriver{
+		signs:  signs,
+		images: make(map[string]*protos.Image),
+	}
+}
+
+// Get information on the signs
+func (m *memoryDriver) GetInfo(_ context.Context, _ *protos.GetInfoRequest, _ ...grpc.CallOption) (*protos.GetInfoResponse, error) {
+	return &protos.GetInfoResponse{
+		Signs: m.signs,
+		Capabilities: []protos.GetInfoResponse_Capability{
+			protos.GetInfoResponse_LIGHT,
+			protos.GetInfoResponse_TEST,
+		},
+		Version: "memory",
+	}, nil
+}
+
+// Record an image drawn on the specified sign
+func (m *memoryDriver) Draw(_ context.Context, request *protos.DrawRequest, _ ...grpc.CallOption) (*protos.DrawResponse, error) {
+	sign, err := findSign(m.signs, request)
+	if err != nil {
+		return nil, err
+	}
+	m.mux.Lock()
+	m.images[sign.Name] = request.Image
+	m.mux.Unlock()
+	log.Printf("Drew on %s:\n%s", sign.Name, render(request.Image.Data, sign.Width))
+	return &protos.DrawResponse{}, nil
+}
+
+// Streaming isn't needed in-process, so callers draw an image at a time
+func (m *memoryDriver) DrawStream(_ context.Context, _ ...grpc.CallOption) (protos.Driver_DrawStreamClient, error) {
+	return nil, status.Error(codes.Unimplemented, "Streamed drawing not supported")
+}
+
+// Record the state of the test sequence
+func (m *memoryDriver) Test(_ context.Context, request *protos.TestRequest, _ ...grpc.CallOption) (*protos.TestResponse, error) {
+	switch request.Action {
+	case protos.TestRequest_START, protos.TestRequest_STOP:
+		m.mux.Lock()
+		m.isTesting = request.Action == protos.TestRequest_START
+		m.mux.Unlock()
+		log.Printf("Test %s", request.Action)
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "Unknown test action: %s", request.Action)
+	}
+	return &protos.TestResponse{}, nil
+}
+
+// Record the state of the light
+func (m *memoryDriver) Light(_ context.Context, request *protos.LightRequest, _ ...grpc.CallOption) (*protos.LightResponse, error) {
+	switch request.Status {
+	case protos.LightRequest_ON, protos.LightRequest_OFF:
+		m.mux.Lock()
+		m.isLightOn = request.Status == protos.LightRequest_ON
+		m.mux.Unlock()
+		log.Printf("Light %s", request.Status)
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "Unknown light status: %s", request.Status)
+	}
+	return &protos.LightResponse{}, nil
+}
+
+// Get the image last drawn on the specified sign (nil if none)
+func (m *memoryDriver) Image(sign string) *protos.Image {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.images[sign]
+}
+
+// Report whether the light is on
+func (m *memoryDriver) IsLightOn() bool {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.isLightOn
+}
+
+// Report whether the test sequence is running
+func (m *memoryDriver) IsTesting() bool {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.isTesting
+}
+
+// Find the sign a request is for, checking the image fits it
+func findSign(signs []*protos.GetInfoResponse_SignInfo, request *protos.DrawRequest) (*protos.GetInfoResponse_SignInfo, error) {
+	for _, sign := range signs {
+		if sign.Name != request.Sign {
+			continue
+		}
+		if pixels := len(request.GetImage().GetData()); uint32(pixels) != sign.Width*sign.Height {
+			return nil, status.Errorf(codes.InvalidArgument, "Image has %d pixels, sign %s has %d", pixels, sign.Name, sign.Width*sign.Height)
+		}
+		return sign, nil
+	}
+	return nil, status.Errorf(codes.NotFound, "Unknown sign: %s", request.Sign)
+}
+
+// Render an image as text, for logging
+func render(data []bool, width uint32) string {
+	var builder strings.Builder
+	for i, pixel := range data {
+		if pixel {
+			builder.WriteRune('#')
+		} else {
+			builder.WriteRune('.')
+		}
+		if uint32(i+1)%width == 0 && i+1 < len(data) {
+			builder.WriteRune('\n')
+		}
+	}
+	return builder.String()
+}
@@ -0,0 +1,72 @@
+package driver
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+
+	"github.com/briggySmalls/flipdot/app/internal/protos"
+	grpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Driver that writes each sign's image to a PNG file
+type pngDriver struct {
+	MemoryDriver
+	// Directory to write images to
+	dir string
+	// Size of each pixel, in the written image
+	scale int
+}
+
+// Creates a driver that writes images drawn on each sign to <dir>/<sign>.png
+func NewPngDriver(signs []*protos.GetInfoResponse_SignInfo, dir string, scale int) protos.DriverClient {
+	return &pngDriver{
+		MemoryDriver: NewMemoryDriver(signs),
+		dir:          dir,
+		scale:        scale,
+	}
+}
+
+// Draw an image on the specified sign, and write it to disk
+func (p *pngDriver) Draw(ctx context.Context, request *protos.DrawRequest, opts ...grpc.CallOption) (*protos.DrawResponse, error) {
+	response, err := p.MemoryDriver.Draw(ctx, request, opts...)
+	if err != nil {
+		return nil, err
+	}
+	// Find the sign's dimensions (we know it exists)
+	info, _ := p.GetInfo(ctx, &protos.GetInfoRequest{})
+	sign, _ := findSign(info.Signs, request)
+	err = writePng(filepath.Join(p.dir, sign.Name+".png"), request.Image.Data, int(sign.Width), p.scale)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to write image: %s", err)
+	}
+	return response, nil
+}
+
+// Write a row-major image to a PNG file, with each pixel scaled up
+func writePng(path string, data []bool, width, scale int) (err error) {
+	height := len(data) / width
+	img := image.NewGray(image.Rect(0, 0, width*scale, height*scale))
+	for i, pixel := range data {
+		if !pixel {
+			continue
+		}
+		col, row := i%width, i/width
+		for y := row * scale; y < (row+1)*scale; y++ {
+			for x := col * scale; x < (col+1)*scale; x++ {
+				img.SetGray(x, y, color.Gray{255})
+			}
+		}
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	return png.Encode(file, img)
+}
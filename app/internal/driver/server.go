@@ -0,0 +1,175 @@
+package driver
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/briggySmalls/flipdot/app/internal/bitmap"
+	"github.com/briggySmalls/flipdot/app/internal/protos"
+	grpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type driverServer struct {
+	// Backend that handles the requests
+	backend protos.DriverClient
+	// Image last drawn on each sign, so regions can be drawn over them
+	images map[string]*protos.Image
+	mux    sync.Mutex
+}
+
+// Creates a gRPC server that serves the Driver service from the specified backend
+func NewRpcServer(backend protos.DriverClient) (grpcServer *grpc.Server) {
+	grpcServer = grpc.NewServer()
+	protos.RegisterDriverServer(grpcServer, NewServer(backend))
+	return
+}
+
+// Creates a Driver service that forwards requests to the specified backend
+func NewServer(backend protos.DriverClient) protos.DriverServer {
+	return &driverServer{
+		backend: backend,
+		images:  make(map[string]*protos.Image),
+	}
+}
+
+// Handler for client request of information on connected signs
+func (d *driverServer) GetInfo(ctx context.Context, request *protos.GetInfoRequest) (*protos.GetInfoResponse, error) {
+	info, err := d.backend.GetInfo(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	// The server handles streams, bitmaps and regions itself, whatever the backend
+	// (regions only save traffic from the client, as whole signs are still drawn)
+	response := *info
+	response.Capabilities = append([]protos.GetInfoResponse_Capability{}, info.Capabilities...)
+	response.Capabilities = append(
+		response.Capabilities,
+		protos.GetInfoResponse_STREAM,
+		protos.GetInfoResponse_BITMAP,
+		protos.GetInfoResponse_PARTIAL,
+	)
+	return &response, nil
+}
+
+// Handler for client request to draw an image on a sign
+func (d *driverServer) Draw(ctx context.Context, request *protos.DrawRequest) (*protos.DrawResponse, error) {
+	return d.draw(ctx, request)
+}
+
+// Handler for a client streaming frames, each drawn across the signs before it is acknowledged
+func (d *driverServer) DrawStream(stream protos.Driver_DrawStreamServer) error {
+	var last uint64
+	for {
+		frame, err := stream.Recv()
+		if err == io.EOF {
+			// The client has finished sending frames
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if frame.Sequence <= last {
+			return status.Errorf(codes.InvalidArgument, "Frame %d received after frame %d", frame.Sequence, last)
+		}
+		last = frame.Sequence
+		// Draw the frame's images
+		for _, request := range frame.Images {
+			_, err = d.draw(stream.Context(), request)
+			if err != nil {
+				return err
+			}
+		}
+		err = stream.Send(&protos.DrawFrameResponse{Sequence: frame.Sequence})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Handler for client request to start or stop the test sequence
+func (d *driverServer) Test(ctx context.Context, request *protos.TestRequest) (*protos.TestResponse, error) {
+	return d.backend.Test(ctx, request)
+}
+
+// Handler for client request to turn the light on or off
+func (d *driverServer) Light(ctx context.Context, request *protos.LightRequest) (*protos.LightResponse, error) {
+	return d.backend.Light(ctx, request)
+}
+
+// Draw a request's image with the backend, remembering it for regions drawn later
+func (d *driverServer) draw(ctx context.Context, request *protos.DrawRequest) (*protos.DrawResponse, error) {
+	request, err := unpackRequest(request)
+	if err != nil {
+		return nil, err
+	}
+	request, err = d.fillRegion(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	response, err := d.backend.Draw(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	d.mux.Lock()
+	d.images[request.Sign] = request.Image
+	d.mux.Unlock()
+	return response, nil
+}
+
+// Draw a request's region over the image last drawn on its sign, so backends needn't understand regions
+//
+// Backends are sent the whole sign, as Hanover signs can't be written a region
+// at a time, so this saves traffic from the client but not writes to the sign.
+func (d *driverServer) fillRegion(ctx context.Context, request *protos.DrawRequest) (*protos.DrawRequest, error) {
+	region := request.GetRegion()
+	if region == nil {
+		return request, nil
+	}
+	info, err := d.backend.GetInfo(ctx, &protos.GetInfoRequest{})
+	if err != nil {
+		return nil, err
+	}
+	var sign *protos.GetInfoResponse_SignInfo
+	for _, s := range info.Signs {
+		if s.Name == request.Sign {
+			sign = s
+		}
+	}
+	if sign == nil {
+		return nil, status.Errorf(codes.NotFound, "Unknown sign: %s", request.Sign)
+	}
+	// Check the region lies on the sign, and the image covers it
+	if uint64(region.X)+uint64(region.Width) > uint64(sign.Width) || uint64(region.Y)+uint64(region.Height) > uint64(sign.Height) {
+		return nil, status.Errorf(codes.InvalidArgument, "Region %dx%d at (%d, %d) is outside sign %s", region.Width, region.Height, region.X, region.Y, sign.Name)
+	}
+	data := request.GetImage().GetData()
+	if uint64(len(data)) != uint64(region.Width)*uint64(region.Height) {
+		return nil, status.Errorf(codes.InvalidArgument, "Image has %d pixels, region has %d", len(data), region.Width*region.Height)
+	}
+	d.mux.Lock()
+	last, ok := d.images[sign.Name]
+	d.mux.Unlock()
+	if !ok || uint32(len(last.Data)) != sign.Width*sign.Height {
+		// We don't know what the rest of the sign shows (perhaps we've restarted)
+		return nil, status.Errorf(codes.FailedPrecondition, "No image drawn on sign %s to draw a region over", sign.Name)
+	}
+	return &protos.DrawRequest{
+		Sign:  sign.Name,
+		Image: &protos.Image{Data: bitmap.Paste(last.Data, uint(sign.Width), region, data)},
+	}, nil
+}
+
+// Convert a request's image to image data, so backends needn't understand bitmaps
+func unpackRequest(request *protos.DrawRequest) (*protos.DrawRequest, error) {
+	if request.GetImage().GetBitmap() == nil {
+		return request, nil
+	}
+	// We don't know which sign the image is for yet, so can only apply a fixed limit
+	image, err := bitmap.Unpacked(request.Image, bitmap.MaxPixels)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid image: %s", err)
+	}
+	return &protos.DrawRequest{Sign: request.Sign, Image: image, Region: request.Region}, nil
+}
@@ -0,0 +1,67 @@
+package events
+
+import (
+	"log"
+	"sync"
+
+	"github.com/briggySmalls/flipdot/app/internal/protos"
+	"github.com/golang/protobuf/ptypes"
+)
+
+type Hub interface {
+	Publish(event *protos.Event)
+	Subscribe() (events <-chan *protos.Event, unsubscribe func())
+}
+
+type hub struct {
+	// Number of events buffered for each subscriber
+	bufferSize int
+	// Channels of active subscribers
+	subscribers map[chan *protos.Event]struct{}
+	mux         sync.Mutex
+}
+
+// Creates a hub that fans events out to any number of subscribers
+func NewHub(bufferSize int) Hub {
+	return &hub{
+		bufferSize:  bufferSize,
+		subscribers: make(map[chan *protos.Event]struct{}),
+	}
+}
+
+// Send an event to all subscribers, without blocking
+func (h *hub) Publish(event *protos.Event) {
+	// Stamp the event, if necessary
+	if event.Time == nil {
+		event.Time = ptypes.TimestampNow()
+	}
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	for subscriber := range h.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			// Subscriber isn't keeping up, so it misses out
+			log.Println("Event dropped for slow subscriber")
+		}
+	}
+}
+
+// Register to receive events, until unsubscribed
+func (h *hub) Subscribe() (<-chan *protos.Event, func()) {
+	subscriber := make(chan *protos.Event, h.bufferSize)
+	h.mux.Lock()
+	h.subscribers[subscriber] = struct{}{}
+	h.mux.Unlock()
+	// Create a function to unsubscribe
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			h.mux.Lock()
+			delete(h.subscribers, subscriber)
+			h.mux.Unlock()
+			close(subscriber)
+		})
+	}
+	return subscriber, unsubscribe
+}
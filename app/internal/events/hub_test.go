@@ -0,0 +1,64 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/briggySmalls/flipdot/app/internal/protos"
+)
+
+func TestFanOut(t *testing.T) {
+	h := NewHub(1)
+	// Subscribe twice
+	first, unsubscribeFirst := h.Subscribe()
+	defer unsubscribeFirst()
+	second, unsubscribeSecond := h.Subscribe()
+	defer unsubscribeSecond()
+	// Publish an event
+	h.Publish(&protos.Event{Payload: &protos.Event_QueueLength{QueueLength: 1}})
+	// Check both subscribers received it
+	for _, events := range []<-chan *protos.Event{first, second} {
+		select {
+		case event := <-events:
+			if event.GetQueueLength() != 1 {
+				t.Errorf("Unexpected event: %s", event.String())
+			}
+			if event.Time == nil {
+				t.Error("Event not timestamped")
+			}
+		default:
+			t.Error("Event not received")
+		}
+	}
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	h := NewHub(1)
+	events, unsubscribe := h.Subscribe()
+	defer unsubscribe()
+	// Publish more events than the subscriber buffers (this must not block)
+	h.Publish(&protos.Event{Payload: &protos.Event_QueueLength{QueueLength: 1}})
+	h.Publish(&protos.Event{Payload: &protos.Event_QueueLength{QueueLength: 2}})
+	// Check the subscriber only got the first
+	event := <-events
+	if event.GetQueueLength() != 1 {
+		t.Errorf("Unexpected event: %s", event.String())
+	}
+	select {
+	case event := <-events:
+		t.Errorf("Unexpected event: %s", event.String())
+	default:
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	h := NewHub(1)
+	events, unsubscribe := h.Subscribe()
+	// Unsubscribe (twice, which should be harmless)
+	unsubscribe()
+	unsubscribe()
+	// Check the channel is closed, and publishing still works
+	if _, ok := <-events; ok {
+		t.Error("Channel not closed")
+	}
+	h.Publish(&protos.Event{Payload: &protos.Event_QueueLength{QueueLength: 1}})
+}
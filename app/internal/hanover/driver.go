@@ -0,0 +1,161 @@
+package hanover
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/briggySmalls/flipdot/app/internal/button"
+	"github.com/briggySmalls/flipdot/app/internal/protos"
+	"github.com/tarm/serial"
+	grpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Configuration of a sign attached to the serial port
+type Sign struct {
+	Name    string
+	Address uint8
+	Width   uint
+	Height  uint
+	// Whether the sign is mounted upside down
+	Flip bool
+}
+
+type driver struct {
+	// Serial port the signs are attached to
+	port io.Writer
+	mux  sync.Mutex
+	// Signs attached to the port, in the order they were configured
+	signs []Sign
+	// Pin that powers the light (optional)
+	lightPin button.OutputPin
+}
+
+// Creates a driver that controls Hanover signs directly over a serial port
+func NewDriver(port io.Writer, signs []Sign, lightPin button.OutputPin) protos.DriverClient {
+	return &driver{
+		port:     port,
+		signs:    signs,
+		lightPin: lightPin,
+	}
+}
+
+// Open a serial port configured for talking to Hanover signs
+func OpenPort(name string, baud int) (io.ReadWriteCloser, error) {
+	return serial.OpenPort(&serial.Config{Name: name, Baud: baud})
+}
+
+// Get information on the attached signs
+func (d *driver) GetInfo(_ context.Context, _ *protos.GetInfoRequest, _ ...grpc.CallOption) (*protos.GetInfoResponse, error) {
+	response := protos.GetInfoResponse{
+		Capabilities: []protos.GetInfoResponse_Capability{
+			protos.GetInfoResponse_TEST,
+			protos.GetInfoResponse_FLIP,
+		},
+		Version: "hanover",
+	}
+	if d.lightPin != nil {
+		response.Capabilities = append(response.Capabilities, protos.GetInfoResponse_LIGHT)
+	}
+	for _, sign := range d.signs {
+		response.Signs = append(response.Signs, &protos.GetInfoResponse_SignInfo{
+			Name:   sign.Name,
+			Width:  uint32(sign.Width),
+			Height: uint32(sign.Height),
+		})
+	}
+	return &response, nil
+}
+
+// Draw an image on the specified sign
+func (d *driver) Draw(_ context.Context, request *protos.DrawRequest, _ ...grpc.CallOption) (*protos.DrawResponse, error) {
+	// Find the sign
+	sign, ok := d.find(request.Sign)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "Unknown sign: %s", request.Sign)
+	}
+	// Check the image fits the sign
+	data := request.GetImage().GetData()
+	if uint(len(data)) != sign.Width*sign.Height {
+		return nil, status.Errorf(codes.InvalidArgument, "Image has %d pixels, sign %s has %d", len(data), sign.Name, sign.Width*sign.Height)
+	}
+	if sign.Flip {
+		data = rotate(data)
+	}
+	err := d.write(encodeImagePacket(sign.Address, data, sign.Width, sign.Height))
+	if err != nil {
+		return nil, err
+	}
+	return &protos.DrawResponse{}, nil
+}
+
+// Streaming gains nothing over a serial port, so callers draw an image at a time
+func (d *driver) DrawStream(_ context.Context, _ ...grpc.CallOption) (protos.Driver_DrawStreamClient, error) {
+	return nil, status.Error(codes.Unimplemented, "Streamed drawing not supported")
+}
+
+// Start or stop the signs' test sequence
+func (d *driver) Test(_ context.Context, request *protos.TestRequest, _ ...grpc.CallOption) (*protos.TestResponse, error) {
+	var command byte
+	switch request.Action {
+	case protos.TestRequest_START:
+		command = commandTestStart
+	case protos.TestRequest_STOP:
+		command = commandTestStop
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "Unknown test action: %s", request.Action)
+	}
+	err := d.write(encodePacket(command, 0, nil))
+	if err != nil {
+		return nil, err
+	}
+	return &protos.TestResponse{}, nil
+}
+
+// Turn the light on or off
+func (d *driver) Light(_ context.Context, request *protos.LightRequest, _ ...grpc.CallOption) (*protos.LightResponse, error) {
+	if d.lightPin == nil {
+		return nil, status.Error(codes.Unimplemented, "No light pin configured")
+	}
+	switch request.Status {
+	case protos.LightRequest_ON:
+		d.lightPin.High()
+	case protos.LightRequest_OFF:
+		d.lightPin.Low()
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "Unknown light status: %s", request.Status)
+	}
+	return &protos.LightResponse{}, nil
+}
+
+// Get the configuration of the sign with the specified name
+func (d *driver) find(name string) (Sign, bool) {
+	for _, sign := range d.signs {
+		if sign.Name == name {
+			return sign, true
+		}
+	}
+	return Sign{}, false
+}
+
+// Write a packet to the serial port
+func (d *driver) write(packet []byte) error {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	_, err := d.port.Write(packet)
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "Failed to write to serial port: %s", err)
+	}
+	return nil
+}
+
+// Rotate a row-major image by 180 degrees
+func rotate(data []bool) []bool {
+	rotated := make([]bool, len(data))
+	for i, pixel := range data {
+		rotated[len(data)-1-i] = pixel
+	}
+	return rotated
+}
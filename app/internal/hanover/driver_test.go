@@ -0,0 +1,166 @@
+package hanover
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	reflect "reflect"
+	"testing"
+
+	"github.com/briggySmalls/flipdot/app/internal/protos"
+	"github.com/kr/pty"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Packet decoded from the serial port
+type packet struct {
+	command byte
+	address byte
+	message []byte
+}
+
+func TestGetInfo(t *testing.T) {
+	d := NewDriver(nil, getTestSigns(), nil)
+	response, err := d.GetInfo(context.Background(), &protos.GetInfoRequest{})
+	failOnError(err, t)
+	if len(response.Signs) != 2 || response.Signs[0].Name != "top" || response.Signs[1].Width != 3 {
+		t.Errorf("Unexpected signs: %s", response.String())
+	}
+}
+
+func TestDraw(t *testing.T) {
+	d, packets, cleanup := createTestObjects(t)
+	defer cleanup()
+	// Draw an image on each sign (with the top sign flipped)
+	image := &protos.Image{Data: []bool{true, false, false, false, false, false}}
+	_, err := d.Draw(context.Background(), &protos.DrawRequest{Sign: "bottom", Image: image})
+	failOnError(err, t)
+	_, err = d.Draw(context.Background(), &protos.DrawRequest{Sign: "top", Image: image})
+	failOnError(err, t)
+	// Check the packets that arrived
+	checkPacket(t, <-packets, packet{commandImage, 1, []byte("03010000")})
+	checkPacket(t, <-packets, packet{commandImage, 2, []byte("03000002")})
+}
+
+func TestDrawInvalid(t *testing.T) {
+	d := NewDriver(nil, getTestSigns(), nil)
+	// Check unknown signs are rejected
+	_, err := d.Draw(context.Background(), &protos.DrawRequest{Sign: "middle", Image: &protos.Image{Data: make([]bool, 6)}})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	// Check images of the wrong size are rejected
+	_, err = d.Draw(context.Background(), &protos.DrawRequest{Sign: "top", Image: &protos.Image{Data: make([]bool, 5)}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestTest(t *testing.T) {
+	d, packets, cleanup := createTestObjects(t)
+	defer cleanup()
+	// Start and stop the test sequence
+	_, err := d.Test(context.Background(), &protos.TestRequest{Action: protos.TestRequest_START})
+	failOnError(err, t)
+	_, err = d.Test(context.Background(), &protos.TestRequest{Action: protos.TestRequest_STOP})
+	failOnError(err, t)
+	// Check the packets that arrived
+	checkPacket(t, <-packets, packet{commandTestStart, 0, []byte{}})
+	checkPacket(t, <-packets, packet{commandTestStop, 0, []byte{}})
+}
+
+func TestLightUnconfigured(t *testing.T) {
+	d := NewDriver(nil, getTestSigns(), nil)
+	_, err := d.Light(context.Background(), &protos.LightRequest{Status: protos.LightRequest_ON})
+	if status.Code(err) != codes.Unimplemented {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+// Helper function to create a driver attached to a pseudo-terminal, and decode the packets it sends
+func createTestObjects(t *testing.T) (protos.DriverClient, chan packet, func()) {
+	// Create a pseudo-terminal to act as the signs
+	master, slave, err := pty.Open()
+	failOnError(err, t)
+	// Open the other end as a serial port
+	port, err := OpenPort(slave.Name(), 9600)
+	failOnError(err, t)
+	// Decode packets as they arrive
+	packets := make(chan packet, 10)
+	go func() {
+		reader := bufio.NewReader(master)
+		for {
+			p, err := readPacket(reader)
+			if err != nil {
+				close(packets)
+				return
+			}
+			packets <- p
+		}
+	}()
+	cleanup := func() {
+		port.Close()
+		slave.Close()
+		master.Close()
+	}
+	return NewDriver(port, getTestSigns(), nil), packets, cleanup
+}
+
+// Helper function to read and check a single packet
+func readPacket(reader *bufio.Reader) (p packet, err error) {
+	// Wait for the start of a packet
+	_, err = reader.ReadBytes(startByte)
+	if err != nil {
+		return
+	}
+	// Read up to the end of the packet, and then the checksum
+	body, err := reader.ReadBytes(endByte)
+	if err != nil {
+		return
+	}
+	checksumHex := make([]byte, 2)
+	_, err = io.ReadFull(reader, checksumHex)
+	if err != nil {
+		return
+	}
+	// Validate the checksum
+	sum, err := hex.DecodeString(string(checksumHex))
+	if err != nil {
+		return
+	}
+	if expected := checksum(append([]byte{startByte}, body...)); sum[0] != expected {
+		return p, fmt.Errorf("Checksum %X != %X", sum[0], expected)
+	}
+	// Pull out the fields
+	header, err := hex.DecodeString("0" + string(body[0:1]) + "0" + string(body[1:2]))
+	if err != nil {
+		return
+	}
+	p = packet{command: header[0], address: header[1], message: body[2 : len(body)-1]}
+	return
+}
+
+// Helper function to check a packet is as expected
+func checkPacket(t *testing.T, actual, expected packet) {
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Unexpected packet: %X %X %q (expected %X %X %q)", actual.command, actual.address, actual.message, expected.command, expected.address, expected.message)
+	}
+}
+
+// Helper function to get the configuration of some small signs
+func getTestSigns() []Sign {
+	return []Sign{
+		{Name: "top", Address: 2, Width: 3, Height: 2, Flip: true},
+		{Name: "bottom", Address: 1, Width: 3, Height: 2},
+	}
+}
+
+// Helper function to stop a test in the event of an error
+func failOnError(err error, t *testing.T) {
+	if err != nil {
+		t.Fatal(err)
+	}
+}
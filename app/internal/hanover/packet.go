@@ -0,0 +1,76 @@
+package hanover
+
+import (
+	"fmt"
+)
+
+const (
+	startByte = 0x02 // Marks the start of every packet
+	endByte   = 0x03 // Marks the end of every packet (followed by the checksum)
+)
+
+// Hanover protocol commands
+const (
+	commandImage     = 0x1
+	commandTestStart = 0x3
+	commandTestStop  = 0xC
+)
+
+// Encode a packet, framed and checksummed ready to send over serial
+func encodePacket(command, address byte, message []byte) []byte {
+	packet := []byte{startByte}
+	// Command and address take a single ASCII hex digit each
+	packet = append(packet, []byte(fmt.Sprintf("%1X%1X", command&0xF, address&0xF))...)
+	packet = append(packet, message...)
+	packet = append(packet, endByte)
+	// Finish with the checksum, in ASCII hex
+	return append(packet, toASCIIHex([]byte{checksum(packet)})...)
+}
+
+// Encode a packet that draws an image on the sign with the specified address
+func encodeImagePacket(address byte, data []bool, width, height uint) []byte {
+	columns := packColumns(data, width, height)
+	// The message is the number of data bytes, followed by the data itself
+	message := toASCIIHex([]byte{byte(len(columns))})
+	message = append(message, toASCIIHex(columns)...)
+	return encodePacket(commandImage, address, message)
+}
+
+// Calculate the checksum of a packet, which includes everything after the start byte
+func checksum(packet []byte) byte {
+	var total byte
+	for _, b := range packet[1:] {
+		total += b
+	}
+	return ^total + 1
+}
+
+// Pack a row-major image into bytes, a column at a time
+//
+// Each column is padded to a whole number of bytes, and sent starting from the
+// bottom row, most significant bit first.
+func packColumns(data []bool, width, height uint) []byte {
+	rows := (height + 7) / 8 * 8
+	packed := make([]byte, 0, width*rows/8)
+	for col := uint(0); col < width; col++ {
+		var current byte
+		for i := uint(0); i < rows; i++ {
+			// Count rows up from the bottom of the padded column
+			row := rows - 1 - i
+			current <<= 1
+			if row < height && data[row*width+col] {
+				current |= 1
+			}
+			if i%8 == 7 {
+				packed = append(packed, current)
+				current = 0
+			}
+		}
+	}
+	return packed
+}
+
+// Convert bytes to upper-case ASCII hex characters
+func toASCIIHex(data []byte) []byte {
+	return []byte(fmt.Sprintf("%X", data))
+}
@@ -0,0 +1,49 @@
+package hanover
+
+import (
+	reflect "reflect"
+	"testing"
+)
+
+func TestEncodePacket(t *testing.T) {
+	// Prepare test table
+	tables := []struct {
+		command byte
+		address byte
+		message []byte
+		packet  []byte
+	}{
+		{commandTestStart, 0, nil, []byte("\x0230\x039A")},
+		{commandTestStop, 0, nil, []byte("\x02C0\x038A")},
+		{commandImage, 2, []byte("01FF"), []byte("\x021201FF\x03AD")},
+	}
+	for _, table := range tables {
+		packet := encodePacket(table.command, table.address, table.message)
+		if !reflect.DeepEqual(packet, table.packet) {
+			t.Errorf("Unexpected packet: %q (expected %q)", packet, table.packet)
+		}
+	}
+}
+
+func TestPackColumns(t *testing.T) {
+	// Prepare test table
+	tables := []struct {
+		data   []bool
+		width  uint
+		height uint
+		packed []byte
+	}{
+		// Top-left pixel only
+		{[]bool{true, false, false, false, false, false}, 2, 3, []byte{0x01, 0x00}},
+		// Bottom row only
+		{[]bool{false, false, false, false, true, true}, 2, 3, []byte{0x04, 0x04}},
+		// Tall column, spanning two bytes (bottom half sent first)
+		{[]bool{true, false, false, false, false, false, false, false, false, true}, 1, 10, []byte{0x02, 0x01}},
+	}
+	for _, table := range tables {
+		packed := packColumns(table.data, table.width, table.height)
+		if !reflect.DeepEqual(packed, table.packed) {
+			t.Errorf("Unexpected packing: %X (expected %X)", packed, table.packed)
+		}
+	}
+}
@@ -8,14 +8,15 @@ import (
 	"image"
 	"time"
 
+	"github.com/briggySmalls/flipdot/app/internal/bitmap"
 	"github.com/briggySmalls/flipdot/app/internal/protos"
-	"github.com/briggySmalls/flipdot/app/internal/shared"
 	"github.com/briggySmalls/flipdot/app/internal/text"
 )
 
 type Imager interface {
 	Message(sender, message string) ([]*protos.Image, error)
 	Clock(time time.Time, isMessagesAvailable bool) ([]*protos.Image, error)
+	Text(text string, isMessagesAvailable bool) ([]*protos.Image, error)
 }
 
 type imager struct {
@@ -41,12 +42,7 @@ func (i *imager) Message(sender, message string) (images []*protos.Image, err er
 	}
 	// Add empty images to fill frame, if necessary
 	for uint(len(senderImages))%i.signCount != 0 {
-		var emptyImage []draw.Image
-		emptyImage, err = i.builder.Images("", false)
-		if err != nil {
-			return
-		}
-		senderImages = append(senderImages, emptyImage[0])
+		senderImages = append(senderImages, i.builder.Blank(len(senderImages)))
 	}
 	// Convert the text to images
 	messageImages, err := i.builder.Images(message, true)
@@ -62,8 +58,15 @@ func (i *imager) Message(sender, message string) (images []*protos.Image, err er
 
 func (i *imager) Clock(time time.Time, isMessagesAvailable bool) (images []*protos.Image, err error) {
 	// Get images that represent the time
-	srcImages, err := i.builder.Images(time.Format("Mon 2 Jan\n3:04 pm"), true)
-	shared.ErrorHandler(err)
+	return i.Text(time.Format("Mon 2 Jan\n3:04 pm"), isMessagesAvailable)
+}
+
+// Get images of centred text, with the status shown if necessary
+func (i *imager) Text(text string, isMessagesAvailable bool) (images []*protos.Image, err error) {
+	srcImages, err := i.builder.Images(text, true)
+	if err != nil {
+		return
+	}
 	// Add status if necessary
 	if isMessagesAvailable {
 		// Get far-right area the size of status image
@@ -91,6 +94,25 @@ func Slice(image image.Image) []bool {
 	return binImage
 }
 
+// Unpacks an image of the specified dimensions, whichever way it is encoded
+func Unslice(imgIn *protos.Image, width, height uint) (image.Image, error) {
+	pixels, err := bitmap.Pixels(imgIn, uint64(width)*uint64(height))
+	if err != nil {
+		return nil, err
+	}
+	if uint(len(pixels)) != width*height {
+		return nil, fmt.Errorf("Image has %d pixels, expected %dx%d", len(pixels), width, height)
+	}
+	// Create an image to hold the unpacked pixels
+	imgOut := image.NewGray(image.Rect(0, 0, int(width), int(height)))
+	for i, pixel := range pixels {
+		if pixel {
+			imgOut.SetGray(i%int(width), i/int(width), color.Gray{255})
+		}
+	}
+	return imgOut, nil
+}
+
 func convertImages(inImages []draw.Image) (outImages []*protos.Image) {
 	for _, img := range inImages {
 		outImages = append(outImages, &protos.Image{Data: Slice(img)})
@@ -8,8 +8,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/briggySmalls/flipdot/app/internal/bitmap"
+	"github.com/briggySmalls/flipdot/app/internal/protos"
 	"github.com/briggySmalls/flipdot/app/internal/text"
 	gomock "github.com/golang/mock/gomock"
+	"golang.org/x/image/font/inconsolata"
 )
 
 // Test converting a 2D image into a slice
@@ -30,6 +33,31 @@ func TestSlice(t *testing.T) {
 	}
 }
 
+// Test converting a bitmap back into a 2D image
+func TestUnslice(t *testing.T) {
+	input := image.NewGray(image.Rect(0, 0, 3, 2))
+	input.SetGray(0, 0, color.Gray{255})
+	input.SetGray(2, 1, color.Gray{255})
+	for _, compression := range []protos.Bitmap_Compression{protos.Bitmap_NONE, protos.Bitmap_RUN_LENGTH} {
+		b, err := bitmap.Pack(Slice(input), 3, 2, protos.Bitmap_COLUMN_MAJOR, compression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Check the image survives the round trip
+		output, err := Unslice(&protos.Image{Bitmap: b}, 3, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(Slice(output), Slice(input)) {
+			t.Errorf("Image not unpacked correctly: %v", Slice(output))
+		}
+	}
+	// Check images that don't fit are rejected
+	if _, err := Unslice(&protos.Image{Data: make([]bool, 5)}, 3, 2); err == nil {
+		t.Error("Wrongly sized image not rejected")
+	}
+}
+
 // Test converting the time into images
 func TestClock(t *testing.T) {
 	// Create the test objects
@@ -80,6 +108,48 @@ func TestClockStatus(t *testing.T) {
 	}
 }
 
+// Test the clock is drawn on a single frame of a canvas
+func TestClockCanvas(t *testing.T) {
+	// Create an imager that draws on a canvas two lines tall
+	tb := text.NewCanvasTextBuilder(text.Size{Width: 84, Height: 34}, inconsolata.Regular8x16)
+	imgr := NewImager(tb, nil, 1)
+	// Request time be drawn
+	images, err := imgr.Clock(time.Date(2019, 1, 1, 12, 30, 0, 0, time.UTC), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Check both lines share one canvas frame
+	if len(images) != 1 {
+		t.Fatalf("Unexpected number of images %d", len(images))
+	}
+	if len(images[0].Data) != 84*34 {
+		t.Errorf("Unexpected image size %d", len(images[0].Data))
+	}
+}
+
+func TestText(t *testing.T) {
+	// Create the test objects
+	statusImage := createTestImage(color.Gray{255}, image.Rect(0, 0, 1, 1))
+	imgr, tb := createImagerTestObjects(t, 2, 1, statusImage)
+
+	// Expect a call to create images from text
+	tb.EXPECT().Images("hello\nworld", true).Return([]draw.Image{
+		image.NewGray(image.Rect(0, 0, 2, 1)),
+	}, nil)
+	// Request text be drawn, with status image
+	images, err := imgr.Text("hello\nworld", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Check the status was added
+	if len(images) != 1 {
+		t.Fatalf("Unexpected number of images %d", len(images))
+	}
+	if images[0].Data[0] || !images[0].Data[1] {
+		t.Error("Status image not set")
+	}
+}
+
 func TestMessage(t *testing.T) {
 	// Create test objects
 	imgr, tb := createImagerTestObjects(t, 1, 1, nil)
@@ -88,7 +158,7 @@ func TestMessage(t *testing.T) {
 	fakeImages := []draw.Image{image.NewGray(image.Rect(0, 0, 1, 1))}
 	gomock.InOrder(
 		tb.EXPECT().Images("From: Sam", true).Return(fakeImages, nil),
-		tb.EXPECT().Images("", false).Return(fakeImages, nil),
+		tb.EXPECT().Blank(1).Return(fakeImages[0]),
 		tb.EXPECT().Images("hello", true).Return(fakeImages, nil),
 	)
 	// Call message
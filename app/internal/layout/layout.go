@@ -0,0 +1,128 @@
+package layout
+
+import (
+	"fmt"
+
+	"github.com/briggySmalls/flipdot/app/internal/protos"
+)
+
+// Way a sign is mounted, relative to the canvas
+type Orientation int
+
+const (
+	// Sign is mounted the right way up
+	Landscape Orientation = iota
+	// Sign is mounted turned a quarter turn clockwise
+	Portrait
+)
+
+// Where a sign sits on the canvas
+type Placement struct {
+	// Name of the sign, as reported by the driver
+	Sign string
+	// Offset of the sign's top-left corner from the canvas's top-left corner
+	X, Y uint
+	// Way the sign is mounted
+	Orientation Orientation
+}
+
+// A virtual canvas spanning several signs
+type Layout interface {
+	Size() (width, height uint)
+	Slice(canvas *protos.Image) (map[string]*protos.Image, error)
+}
+
+type layout struct {
+	placements []Placement
+	signs      map[string]*protos.GetInfoResponse_SignInfo
+	width      uint
+	height     uint
+}
+
+// Create a canvas from placements of the specified signs, sized to cover them all
+func NewLayout(placements []Placement, signs []*protos.GetInfoResponse_SignInfo) (Layout, error) {
+	if len(placements) == 0 {
+		return nil, fmt.Errorf("Layout has no signs")
+	}
+	l := layout{
+		placements: placements,
+		signs:      make(map[string]*protos.GetInfoResponse_SignInfo),
+	}
+	for _, sign := range signs {
+		l.signs[sign.Name] = sign
+	}
+	// Find the extent of the signs
+	placed := make(map[string]bool)
+	for _, placement := range placements {
+		sign, ok := l.signs[placement.Sign]
+		if !ok {
+			return nil, fmt.Errorf("Layout places unknown sign: %s", placement.Sign)
+		}
+		if placed[placement.Sign] {
+			return nil, fmt.Errorf("Layout places sign more than once: %s", placement.Sign)
+		}
+		placed[placement.Sign] = true
+		width, height := footprint(placement, sign)
+		if right := placement.X + width; right > l.width {
+			l.width = right
+		}
+		if bottom := placement.Y + height; bottom > l.height {
+			l.height = bottom
+		}
+	}
+	return &l, nil
+}
+
+// Parse an orientation from its name in configuration
+func ParseOrientation(name string) (Orientation, error) {
+	switch name {
+	case "", "landscape":
+		return Landscape, nil
+	case "portrait":
+		return Portrait, nil
+	default:
+		return Landscape, fmt.Errorf("Unknown orientation: %s", name)
+	}
+}
+
+// Get the dimensions of the canvas
+func (l *layout) Size() (width, height uint) {
+	return l.width, l.height
+}
+
+// Cut an image of the whole canvas into an image for each placed sign
+func (l *layout) Slice(canvas *protos.Image) (images map[string]*protos.Image, err error) {
+	if uint(len(canvas.Data)) != l.width*l.height {
+		return nil, fmt.Errorf("Image has %d dots, but canvas is %dx%d", len(canvas.Data), l.width, l.height)
+	}
+	images = make(map[string]*protos.Image)
+	for _, placement := range l.placements {
+		sign := l.signs[placement.Sign]
+		data := make([]bool, sign.Width*sign.Height)
+		for r := uint(0); r < uint(sign.Height); r++ {
+			for c := uint(0); c < uint(sign.Width); c++ {
+				x, y := position(placement, sign, c, r)
+				data[r*uint(sign.Width)+c] = canvas.Data[y*l.width+x]
+			}
+		}
+		images[placement.Sign] = &protos.Image{Data: data}
+	}
+	return
+}
+
+// Get the dimensions a sign covers on the canvas
+func footprint(placement Placement, sign *protos.GetInfoResponse_SignInfo) (width, height uint) {
+	if placement.Orientation == Portrait {
+		return uint(sign.Height), uint(sign.Width)
+	}
+	return uint(sign.Width), uint(sign.Height)
+}
+
+// Get the canvas position of the dot in the specified column and row of a sign
+func position(placement Placement, sign *protos.GetInfoResponse_SignInfo, column, row uint) (x, y uint) {
+	if placement.Orientation == Portrait {
+		// The sign's top edge runs down the right of its footprint
+		return placement.X + uint(sign.Height) - 1 - row, placement.Y + column
+	}
+	return placement.X + column, placement.Y + row
+}
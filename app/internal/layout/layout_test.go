@@ -0,0 +1,127 @@
+package layout
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/briggySmalls/flipdot/app/internal/protos"
+)
+
+func TestSize(t *testing.T) {
+	signs := getTestSigns()
+	// Prepare test table
+	tables := []struct {
+		name       string
+		placements []Placement
+		width      uint
+		height     uint
+	}{
+		{"stacked", []Placement{{Sign: "top"}, {Sign: "bottom", Y: 2}}, 3, 4},
+		{"side-by-side", []Placement{{Sign: "top"}, {Sign: "bottom", X: 3}}, 6, 2},
+		{"portrait", []Placement{{Sign: "top", Orientation: Portrait}, {Sign: "bottom", X: 2, Orientation: Portrait}}, 4, 3},
+		{"single", []Placement{{Sign: "bottom", X: 1, Y: 1}}, 4, 3},
+	}
+	for _, table := range tables {
+		l, err := NewLayout(table.placements, signs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if width, height := l.Size(); width != table.width || height != table.height {
+			t.Errorf("Unexpected %s canvas size: %dx%d", table.name, width, height)
+		}
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	signs := getTestSigns()
+	for _, placements := range [][]Placement{
+		{},
+		{{Sign: "middle"}},
+		{{Sign: "top"}, {Sign: "top", Y: 2}},
+	} {
+		if _, err := NewLayout(placements, signs); err == nil {
+			t.Errorf("Invalid layout not rejected: %v", placements)
+		}
+	}
+}
+
+func TestSlice(t *testing.T) {
+	signs := getTestSigns()
+	// Prepare test table
+	tables := []struct {
+		name       string
+		placements []Placement
+		canvas     []bool
+		top        []bool
+		bottom     []bool
+	}{
+		{
+			"stacked",
+			[]Placement{{Sign: "top"}, {Sign: "bottom", Y: 2}},
+			[]bool{
+				true, false, false,
+				false, true, false,
+				false, false, true,
+				true, true, false,
+			},
+			[]bool{true, false, false, false, true, false},
+			[]bool{false, false, true, true, true, false},
+		},
+		{
+			"portrait",
+			[]Placement{{Sign: "top", Orientation: Portrait}, {Sign: "bottom", X: 2, Orientation: Portrait}},
+			[]bool{
+				true, false, false, true,
+				false, false, true, false,
+				false, true, false, false,
+			},
+			// Rows of the sign run from the right of its footprint to the left
+			[]bool{false, false, true, true, false, false},
+			[]bool{true, false, false, false, true, false},
+		},
+	}
+	for _, table := range tables {
+		l, err := NewLayout(table.placements, signs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		images, err := l.Slice(&protos.Image{Data: table.canvas})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(images["top"].Data, table.top) {
+			t.Errorf("Unexpected %s top image: %v", table.name, images["top"].Data)
+		}
+		if !reflect.DeepEqual(images["bottom"].Data, table.bottom) {
+			t.Errorf("Unexpected %s bottom image: %v", table.name, images["bottom"].Data)
+		}
+	}
+	// Check images that don't cover the canvas are rejected
+	l, err := NewLayout([]Placement{{Sign: "top"}}, signs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Slice(&protos.Image{Data: make([]bool, 5)}); err == nil {
+		t.Error("Wrongly sized image not rejected")
+	}
+}
+
+func TestParseOrientation(t *testing.T) {
+	for name, expected := range map[string]Orientation{"": Landscape, "landscape": Landscape, "portrait": Portrait} {
+		orientation, err := ParseOrientation(name)
+		if err != nil || orientation != expected {
+			t.Errorf("Unexpected orientation for %s: %d", name, orientation)
+		}
+	}
+	if _, err := ParseOrientation("sideways"); err == nil {
+		t.Error("Unknown orientation not rejected")
+	}
+}
+
+// Helper function to get a pair of 3x2 signs
+func getTestSigns() []*protos.GetInfoResponse_SignInfo {
+	return []*protos.GetInfoResponse_SignInfo{
+		{Name: "top", Width: 3, Height: 2},
+		{Name: "bottom", Width: 3, Height: 2},
+	}
+}
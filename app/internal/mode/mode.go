@@ -0,0 +1,69 @@
+package mode
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/briggySmalls/flipdot/app/internal/protos"
+)
+
+// Error returned when a mode has not been registered
+var ErrModeNotFound = errors.New("Mode not registered")
+
+// Something to display on the signs whilst there are no messages being shown
+type Mode interface {
+	Frame(time time.Time, isMessagesAvailable bool) ([]*protos.Image, error)
+}
+
+// Collection of modes, looked up by name
+type Registry interface {
+	Register(name string, mode Mode) error
+	Get(name string) (Mode, error)
+	Names() []string
+}
+
+type registry struct {
+	modes map[string]Mode
+	mux   sync.Mutex
+}
+
+// Creates an empty registry of modes
+func NewRegistry() Registry {
+	return &registry{modes: make(map[string]Mode)}
+}
+
+// Add a mode to the registry, under a unique name
+func (r *registry) Register(name string, mode Mode) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if _, ok := r.modes[name]; ok {
+		return fmt.Errorf("Mode already registered: %s", name)
+	}
+	r.modes[name] = mode
+	return nil
+}
+
+// Get the mode registered under the specified name
+func (r *registry) Get(name string) (Mode, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	mode, ok := r.modes[name]
+	if !ok {
+		return nil, ErrModeNotFound
+	}
+	return mode, nil
+}
+
+// Get the names of all registered modes, in alphabetical order
+func (r *registry) Names() (names []string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for name := range r.modes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
@@ -0,0 +1,68 @@
+package mode
+
+import (
+	reflect "reflect"
+	"testing"
+	"time"
+
+	"github.com/briggySmalls/flipdot/app/internal/imaging"
+	"github.com/briggySmalls/flipdot/app/internal/protos"
+	gomock "github.com/golang/mock/gomock"
+)
+
+func TestRegistry(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	imager := imaging.NewMockImager(ctrl)
+	r := NewRegistry()
+	// Register a couple of modes
+	clock := NewClock(imager)
+	failOnError(r.Register("clock", clock), t)
+	failOnError(r.Register("quote", NewText(imager, "hello")), t)
+	// Check names must be unique
+	if r.Register("clock", clock) == nil {
+		t.Error("Duplicate mode registered")
+	}
+	// Check modes can be looked up
+	if names := r.Names(); !reflect.DeepEqual(names, []string{"clock", "quote"}) {
+		t.Errorf("Unexpected names: %v", names)
+	}
+	mode, err := r.Get("clock")
+	failOnError(err, t)
+	if mode != clock {
+		t.Error("Unexpected mode returned")
+	}
+	if _, err := r.Get("weather"); err != ErrModeNotFound {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestCountdown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	imager := imaging.NewMockImager(ctrl)
+	target := time.Date(2019, 12, 25, 0, 0, 0, 0, time.UTC)
+	mode := NewCountdown(imager, "Christmas", target)
+	// Prepare test table
+	tables := []struct {
+		now  time.Time
+		text string
+	}{
+		{target.Add(-(49*time.Hour + 30*time.Minute)), "Christmas\n2d 1h 30m"},
+		{target.Add(-90 * time.Second), "Christmas\n0h 2m"},
+		{target, "Christmas\nnow!"},
+		{target.Add(time.Hour), "Christmas\nnow!"},
+	}
+	for _, table := range tables {
+		imager.EXPECT().Text(table.text, true).Return([]*protos.Image{}, nil)
+		_, err := mode.Frame(table.now, true)
+		failOnError(err, t)
+	}
+}
+
+// Helper function to stop a test in the event of an error
+func failOnError(err error, t *testing.T) {
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,71 @@
+package mode
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/briggySmalls/flipdot/app/internal/imaging"
+	"github.com/briggySmalls/flipdot/app/internal/protos"
+)
+
+// Mode that displays the date and time
+type clock struct {
+	imager imaging.Imager
+}
+
+// Creates a mode that displays the date and time
+func NewClock(imager imaging.Imager) Mode {
+	return &clock{imager: imager}
+}
+
+func (c *clock) Frame(time time.Time, isMessagesAvailable bool) ([]*protos.Image, error) {
+	return c.imager.Clock(time, isMessagesAvailable)
+}
+
+// Mode that displays the time remaining until an event
+type countdown struct {
+	imager imaging.Imager
+	// Name of the event being counted down to
+	label string
+	// Time of the event
+	target time.Time
+}
+
+// Creates a mode that counts down to the specified time
+func NewCountdown(imager imaging.Imager, label string, target time.Time) Mode {
+	return &countdown{imager: imager, label: label, target: target}
+}
+
+func (c *countdown) Frame(time time.Time, isMessagesAvailable bool) ([]*protos.Image, error) {
+	return c.imager.Text(fmt.Sprintf("%s\n%s", c.label, formatRemaining(c.target.Sub(time))), isMessagesAvailable)
+}
+
+// Mode that displays fixed text, such as a quote of the day
+type text struct {
+	imager imaging.Imager
+	text   string
+}
+
+// Creates a mode that displays the specified text
+func NewText(imager imaging.Imager, txt string) Mode {
+	return &text{imager: imager, text: txt}
+}
+
+func (t *text) Frame(_ time.Time, isMessagesAvailable bool) ([]*protos.Image, error) {
+	return t.imager.Text(t.text, isMessagesAvailable)
+}
+
+// Format a duration as days, hours and minutes
+func formatRemaining(remaining time.Duration) string {
+	if remaining <= 0 {
+		return "now!"
+	}
+	// Round up, so we don't show zero whilst there is still time to go
+	minutes := int((remaining + time.Minute - 1) / time.Minute)
+	days, minutes := minutes/(24*60), minutes%(24*60)
+	hours, minutes := minutes/60, minutes%60
+	if days > 0 {
+		return fmt.Sprintf("%dd %dh %dm", days, hours, minutes)
+	}
+	return fmt.Sprintf("%dh %dm", hours, minutes)
+}
@@ -0,0 +1,61 @@
+package mode
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/briggySmalls/flipdot/app/internal/protos"
+	"github.com/golang/protobuf/ptypes"
+)
+
+// Rotation through a series of modes, each displayed for a set duration
+type Playlist interface {
+	Mode(now time.Time) string
+	Next() time.Time
+	Entries() []*protos.Playlist_Entry
+}
+
+type playlist struct {
+	entries []*protos.Playlist_Entry
+	// Duration of each entry (converted once, up front)
+	durations []time.Duration
+	// Entry currently displayed, and when it started
+	index   int
+	started time.Time
+}
+
+// Creates a playlist that starts with its first entry at the specified time
+func NewPlaylist(entries []*protos.Playlist_Entry, start time.Time) (Playlist, error) {
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("Playlist cannot be empty")
+	}
+	p := playlist{entries: entries, started: start}
+	for _, entry := range entries {
+		duration, err := ptypes.Duration(entry.Duration)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("Duration of %s must be positive", entry.Mode)
+		}
+		p.durations = append(p.durations, duration)
+	}
+	return &p, nil
+}
+
+// Get the name of the mode to display at the specified time, moving on if the current entry is finished
+func (p *playlist) Mode(now time.Time) string {
+	if now.Sub(p.started) >= p.durations[p.index] {
+		// Move on to the next entry (without skipping any, should we have been busy)
+		p.index = (p.index + 1) % len(p.entries)
+		p.started = now
+	}
+	return p.entries[p.index].Mode
+}
+
+// Get the time at which the current entry is finished
+func (p *playlist) Next() time.Time {
+	return p.started.Add(p.durations[p.index])
+}
+
+// Get the entries that make up the playlist
+func (p *playlist) Entries() []*protos.Playlist_Entry {
+	return append([]*protos.Playlist_Entry{}, p.entries...)
+}
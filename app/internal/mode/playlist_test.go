@@ -0,0 +1,69 @@
+package mode
+
+import (
+	"testing"
+	"time"
+
+	"github.com/briggySmalls/flipdot/app/internal/protos"
+	"github.com/golang/protobuf/ptypes"
+)
+
+func TestPlaylist(t *testing.T) {
+	start := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+	p, err := NewPlaylist([]*protos.Playlist_Entry{
+		{Mode: "clock", Duration: ptypes.DurationProto(30 * time.Second)},
+		{Mode: "countdown", Duration: ptypes.DurationProto(10 * time.Second)},
+	}, start)
+	failOnError(err, t)
+	// Prepare test table
+	tables := []struct {
+		offset time.Duration
+		mode   string
+	}{
+		{0, "clock"},
+		{29 * time.Second, "clock"},
+		{30 * time.Second, "countdown"},
+		{39 * time.Second, "countdown"},
+		{40 * time.Second, "clock"},
+		// Entries aren't skipped after a long gap
+		{10 * time.Minute, "countdown"},
+		{10*time.Minute + 10*time.Second, "clock"},
+	}
+	for _, table := range tables {
+		if mode := p.Mode(start.Add(table.offset)); mode != table.mode {
+			t.Errorf("Unexpected mode after %s: %s", table.offset, mode)
+		}
+	}
+}
+
+func TestPlaylistNext(t *testing.T) {
+	start := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+	p, err := NewPlaylist([]*protos.Playlist_Entry{
+		{Mode: "countdown", Duration: ptypes.DurationProto(10 * time.Second)},
+		{Mode: "clock", Duration: ptypes.DurationProto(30 * time.Second)},
+	}, start)
+	failOnError(err, t)
+	// Check the first entry ends after its 10 seconds
+	if next := p.Next(); !next.Equal(start.Add(10 * time.Second)) {
+		t.Errorf("Unexpected first switch: %s", next)
+	}
+	// Check the next entry ends 30 seconds after the switch
+	p.Mode(start.Add(10 * time.Second))
+	if next := p.Next(); !next.Equal(start.Add(40 * time.Second)) {
+		t.Errorf("Unexpected second switch: %s", next)
+	}
+}
+
+func TestPlaylistInvalid(t *testing.T) {
+	// Prepare test table
+	tables := [][]*protos.Playlist_Entry{
+		{},
+		{{Mode: "clock"}},
+		{{Mode: "clock", Duration: ptypes.DurationProto(0)}},
+	}
+	for _, entries := range tables {
+		if _, err := NewPlaylist(entries, time.Now()); err == nil {
+			t.Errorf("Invalid playlist accepted: %v", entries)
+		}
+	}
+}
@@ -0,0 +1,446 @@
+package queue
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/briggySmalls/flipdot/app/internal/protos"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	messagesBucket = []byte("messages")
+	failedBucket   = []byte("failed")
+	metaBucket     = []byte("meta")
+	orderKey       = []byte("order")
+)
+
+// Time to wait for another process to release the database
+const openTimeout = time.Second
+
+// Error returned when a message is not in the queue
+var ErrMessageNotFound = errors.New("Message not in queue")
+
+type MessageQueue interface {
+	Push(message protos.MessageRequest) (*protos.QueuedMessage, error)
+	Peek() *protos.QueuedMessage
+	Remove(id uint64) error
+	Move(id uint64, position int) error
+	Clear() error
+	Expire(now time.Time) (int, error)
+	List() []*protos.QueuedMessage
+	Len() int
+	Fail(id uint64, reason string) error
+	Failed() []*protos.FailedMessage
+	Retry(id uint64) (*protos.QueuedMessage, error)
+	Discard(id uint64) error
+	Close() error
+}
+
+type messageQueue struct {
+	// Database used to persist messages
+	db *bolt.DB
+	// In-memory copy of the persisted messages, in order
+	messages []*protos.QueuedMessage
+	// In-memory copy of the persisted messages that failed, in the order they failed
+	failed []*protos.FailedMessage
+}
+
+// Creates a queue persisted to the specified file, loading any existing messages
+func NewMessageQueue(path string) (q MessageQueue, err error) {
+	// Open the database, giving up if another process holds on to it
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open queue %s (is it in use?): %s", path, err)
+	}
+	queue := messageQueue{db: db}
+	// Load any messages left over from a previous run
+	err = queue.load()
+	if err != nil {
+		db.Close()
+		return
+	}
+	q = &queue
+	return
+}
+
+// Add a message to the queue, behind any messages of equal or higher priority
+func (q *messageQueue) Push(message protos.MessageRequest) (queued *protos.QueuedMessage, err error) {
+	// Find where the message belongs
+	position := len(q.messages)
+	for i, other := range q.messages {
+		if other.Message.Priority < message.Priority {
+			position = i
+			break
+		}
+	}
+	var messages []*protos.QueuedMessage
+	err = q.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(messagesBucket)
+		// Assign the message a unique ID
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		// Record the message
+		queued = &protos.QueuedMessage{
+			Id:       id,
+			Received: ptypes.TimestampNow(),
+			Message:  &message,
+		}
+		err = put(bucket, queued)
+		if err != nil {
+			return err
+		}
+		// Insert the message
+		messages = insert(q.messages, position, queued)
+		if position == len(q.messages) {
+			// Messages at the back are already in order of arrival
+			return nil
+		}
+		return putOrder(tx, messages)
+	})
+	if err != nil {
+		return nil, err
+	}
+	q.messages = messages
+	return
+}
+
+// Get the message at the front of the queue (nil if the queue is empty)
+func (q *messageQueue) Peek() *protos.QueuedMessage {
+	if len(q.messages) == 0 {
+		return nil
+	}
+	return q.messages[0]
+}
+
+// Remove the message with the specified ID from the queue
+func (q *messageQueue) Remove(id uint64) error {
+	// Find the message
+	index := q.find(id)
+	if index < 0 {
+		return ErrMessageNotFound
+	}
+	// Delete it from disk
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(messagesBucket).Delete(itob(id))
+	})
+	if err != nil {
+		return err
+	}
+	// Delete it from memory
+	q.messages = append(q.messages[:index], q.messages[index+1:]...)
+	return nil
+}
+
+// Move the message with the specified ID to a new position in the queue
+func (q *messageQueue) Move(id uint64, position int) error {
+	// Find the message
+	index := q.find(id)
+	if index < 0 {
+		return ErrMessageNotFound
+	}
+	// Limit the position to the back of the queue
+	if position >= len(q.messages) {
+		position = len(q.messages) - 1
+	}
+	// Reorder a copy of the messages
+	message := q.messages[index]
+	messages := append([]*protos.QueuedMessage{}, q.messages[:index]...)
+	messages = insert(append(messages, q.messages[index+1:]...), position, message)
+	// Persist the new order
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		return putOrder(tx, messages)
+	})
+	if err != nil {
+		return err
+	}
+	q.messages = messages
+	return nil
+}
+
+// Remove all messages that have expired by the specified time, returning how many were removed
+func (q *messageQueue) Expire(now time.Time) (count int, err error) {
+	// Find the messages that have expired
+	var remaining, expired []*protos.QueuedMessage
+	for _, message := range q.messages {
+		if isExpired(message, now) {
+			expired = append(expired, message)
+		} else {
+			remaining = append(remaining, message)
+		}
+	}
+	if len(expired) == 0 {
+		return
+	}
+	// Delete them from disk
+	err = q.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(messagesBucket)
+		for _, message := range expired {
+			err := bucket.Delete(itob(message.Id))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	// Delete them from memory
+	q.messages = remaining
+	count = len(expired)
+	return
+}
+
+// Remove all messages from the queue
+func (q *messageQueue) Clear() error {
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		// Delete every message (the bucket is kept so IDs aren't reused)
+		bucket := tx.Bucket(messagesBucket)
+		for _, message := range q.messages {
+			err := bucket.Delete(itob(message.Id))
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(metaBucket).Delete(orderKey)
+	})
+	if err != nil {
+		return err
+	}
+	q.messages = nil
+	return nil
+}
+
+// Get a copy of the messages in the queue, in order
+func (q *messageQueue) List() []*protos.QueuedMessage {
+	return append([]*protos.QueuedMessage{}, q.messages...)
+}
+
+// Get the number of messages in the queue
+func (q *messageQueue) Len() int {
+	return len(q.messages)
+}
+
+// Move the message with the specified ID out of the queue, recording why it failed
+func (q *messageQueue) Fail(id uint64, reason string) error {
+	// Find the message
+	index := q.find(id)
+	if index < 0 {
+		return ErrMessageNotFound
+	}
+	failed := &protos.FailedMessage{
+		Message: q.messages[index],
+		Failed:  ptypes.TimestampNow(),
+		Error:   reason,
+	}
+	// Move it on disk
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(messagesBucket).Delete(itob(id))
+		if err != nil {
+			return err
+		}
+		data, err := proto.Marshal(failed)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(failedBucket).Put(itob(id), data)
+	})
+	if err != nil {
+		return err
+	}
+	// Move it in memory
+	q.messages = append(q.messages[:index], q.messages[index+1:]...)
+	q.failed = append(q.failed, failed)
+	return nil
+}
+
+// Get a copy of the messages that failed, in the order they failed
+func (q *messageQueue) Failed() []*protos.FailedMessage {
+	return append([]*protos.FailedMessage{}, q.failed...)
+}
+
+// Return the failed message with the specified ID to the queue, as if newly received
+func (q *messageQueue) Retry(id uint64) (queued *protos.QueuedMessage, err error) {
+	// Find the message
+	index := q.findFailed(id)
+	if index < 0 {
+		return nil, ErrMessageNotFound
+	}
+	// Queue it again, then forget that it failed
+	queued, err = q.Push(*q.failed[index].Message.Message)
+	if err != nil {
+		return
+	}
+	err = q.Discard(id)
+	return
+}
+
+// Forget the failed message with the specified ID
+func (q *messageQueue) Discard(id uint64) error {
+	// Find the message
+	index := q.findFailed(id)
+	if index < 0 {
+		return ErrMessageNotFound
+	}
+	// Delete it from disk
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(failedBucket).Delete(itob(id))
+	})
+	if err != nil {
+		return err
+	}
+	// Delete it from memory
+	q.failed = append(q.failed[:index], q.failed[index+1:]...)
+	return nil
+}
+
+// Close the underlying database
+func (q *messageQueue) Close() error {
+	return q.db.Close()
+}
+
+// Read all persisted messages into memory
+func (q *messageQueue) load() error {
+	return q.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(messagesBucket)
+		if err != nil {
+			return err
+		}
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+		failed, err := tx.CreateBucketIfNotExists(failedBucket)
+		if err != nil {
+			return err
+		}
+		// Keys are big-endian IDs, so iteration is in order of arrival
+		err = bucket.ForEach(func(_, value []byte) error {
+			message := protos.QueuedMessage{}
+			err := proto.Unmarshal(value, &message)
+			if err != nil {
+				return err
+			}
+			q.messages = append(q.messages, &message)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// Load the messages that failed
+		err = failed.ForEach(func(_, value []byte) error {
+			message := protos.FailedMessage{}
+			err := proto.Unmarshal(value, &message)
+			if err != nil {
+				return err
+			}
+			q.failed = append(q.failed, &message)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		sort.SliceStable(q.failed, func(i, j int) bool {
+			return failedBefore(q.failed[i], q.failed[j])
+		})
+		// Apply any explicit ordering (messages not in it stay at the back)
+		positions := make(map[uint64]int)
+		order := meta.Get(orderKey)
+		for i := 0; i+8 <= len(order); i += 8 {
+			positions[binary.BigEndian.Uint64(order[i:])] = i / 8
+		}
+		sort.SliceStable(q.messages, func(i, j int) bool {
+			iPos, iOk := positions[q.messages[i].Id]
+			jPos, jOk := positions[q.messages[j].Id]
+			if iOk && jOk {
+				return iPos < jPos
+			}
+			return iOk && !jOk
+		})
+		return nil
+	})
+}
+
+// Get the index of the message with the specified ID (-1 if not present)
+func (q *messageQueue) find(id uint64) int {
+	for i, message := range q.messages {
+		if message.Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Get the index of the failed message with the specified ID (-1 if not present)
+func (q *messageQueue) findFailed(id uint64) int {
+	for i, message := range q.failed {
+		if message.Message.Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Determine if a message has expired by the specified time
+func isExpired(message *protos.QueuedMessage, now time.Time) bool {
+	if message.Message.Ttl == nil {
+		// Messages without a TTL never expire
+		return false
+	}
+	received, err := ptypes.Timestamp(message.Received)
+	if err != nil {
+		return false
+	}
+	ttl, err := ptypes.Duration(message.Message.Ttl)
+	if err != nil {
+		return false
+	}
+	return !now.Before(received.Add(ttl))
+}
+
+// Determine if a message failed before another
+func failedBefore(a, b *protos.FailedMessage) bool {
+	aTime, _ := ptypes.Timestamp(a.Failed)
+	bTime, _ := ptypes.Timestamp(b.Failed)
+	return aTime.Before(bTime)
+}
+
+// Get a copy of the messages with a message inserted at the specified position
+func insert(messages []*protos.QueuedMessage, position int, message *protos.QueuedMessage) []*protos.QueuedMessage {
+	inserted := append([]*protos.QueuedMessage{}, messages[:position]...)
+	inserted = append(inserted, message)
+	return append(inserted, messages[position:]...)
+}
+
+// Write a message to the bucket
+func put(bucket *bolt.Bucket, message *protos.QueuedMessage) error {
+	data, err := proto.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(itob(message.Id), data)
+}
+
+// Record the order of the messages
+func putOrder(tx *bolt.Tx, messages []*protos.QueuedMessage) error {
+	var order []byte
+	for _, message := range messages {
+		order = append(order, itob(message.Id)...)
+	}
+	return tx.Bucket(metaBucket).Put(orderKey, order)
+}
+
+// Convert an ID to a sortable database key
+func itob(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
@@ -0,0 +1,293 @@
+package queue
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/briggySmalls/flipdot/app/internal/protos"
+	"github.com/golang/protobuf/ptypes"
+)
+
+func TestPushRemove(t *testing.T) {
+	dir := createTestDir(t)
+	defer os.RemoveAll(dir)
+	q := openTestQueue(t, dir)
+	defer q.Close()
+	// Check the queue starts empty
+	if q.Peek() != nil || q.Len() != 0 {
+		t.Fatal("Queue not initially empty")
+	}
+	// Push a couple of messages
+	first := pushTestMessage(t, q, "first")
+	second := pushTestMessage(t, q, "second")
+	if first.Id == second.Id {
+		t.Fatal("Message IDs not unique")
+	}
+	// Messages should come out in the order they went in
+	if q.Peek().Id != first.Id {
+		t.Errorf("Unexpected message at front of queue: %d", q.Peek().Id)
+	}
+	failOnError(q.Remove(first.Id), t)
+	if q.Peek().Id != second.Id {
+		t.Errorf("Unexpected message at front of queue: %d", q.Peek().Id)
+	}
+	failOnError(q.Remove(second.Id), t)
+	if q.Len() != 0 {
+		t.Errorf("Unexpected queue length: %d", q.Len())
+	}
+	// Removing a message that isn't present should fail
+	if q.Remove(first.Id) == nil {
+		t.Error("Removing missing message did not fail")
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	dir := createTestDir(t)
+	defer os.RemoveAll(dir)
+	// Queue up some messages, then close the queue
+	q := openTestQueue(t, dir)
+	first := pushTestMessage(t, q, "first")
+	second := pushTestMessage(t, q, "second")
+	pushTestMessage(t, q, "third")
+	failOnError(q.Remove(second.Id), t)
+	failOnError(q.Close(), t)
+	// Reopen the queue
+	q = openTestQueue(t, dir)
+	defer q.Close()
+	// Check the remaining messages were restored in order
+	if q.Len() != 2 {
+		t.Fatalf("Unexpected queue length: %d", q.Len())
+	}
+	message := q.Peek()
+	if message.Id != first.Id || message.Message.GetText() != "first" {
+		t.Errorf("Unexpected message restored: %s", message.Message.GetText())
+	}
+	if message.Received == nil {
+		t.Error("Received time not restored")
+	}
+	// Check new messages don't reuse IDs
+	fourth := pushTestMessage(t, q, "fourth")
+	if fourth.Id <= first.Id || fourth.Id == second.Id {
+		t.Errorf("Unexpected ID assigned: %d", fourth.Id)
+	}
+}
+
+func TestOpenInUse(t *testing.T) {
+	dir := createTestDir(t)
+	defer os.RemoveAll(dir)
+	q := openTestQueue(t, dir)
+	defer q.Close()
+	// Check opening the queue again gives up, rather than waiting forever
+	if _, err := NewMessageQueue(filepath.Join(dir, "queue.db")); err == nil {
+		t.Error("Queue in use opened again")
+	}
+}
+
+func TestMove(t *testing.T) {
+	dir := createTestDir(t)
+	defer os.RemoveAll(dir)
+	q := openTestQueue(t, dir)
+	// Push some messages
+	first := pushTestMessage(t, q, "first")
+	second := pushTestMessage(t, q, "second")
+	third := pushTestMessage(t, q, "third")
+	// Move the last message to the front, and the first beyond the back
+	failOnError(q.Move(third.Id, 0), t)
+	failOnError(q.Move(first.Id, 10), t)
+	checkOrder(t, q, third.Id, second.Id, first.Id)
+	// Moving a message that isn't present should fail
+	if q.Move(100, 0) != ErrMessageNotFound {
+		t.Error("Moving missing message did not fail")
+	}
+	// Check the order survives a restart, with new messages at the back
+	fourth := pushTestMessage(t, q, "fourth")
+	failOnError(q.Close(), t)
+	q = openTestQueue(t, dir)
+	defer q.Close()
+	checkOrder(t, q, third.Id, second.Id, first.Id, fourth.Id)
+}
+
+func TestPriority(t *testing.T) {
+	dir := createTestDir(t)
+	defer os.RemoveAll(dir)
+	q := openTestQueue(t, dir)
+	// Push messages of varying priority
+	normal := pushTestMessage(t, q, "normal")
+	high := pushPriorityTestMessage(t, q, "high", protos.MessageRequest_HIGH)
+	urgent := pushPriorityTestMessage(t, q, "urgent", protos.MessageRequest_URGENT)
+	secondHigh := pushPriorityTestMessage(t, q, "second high", protos.MessageRequest_HIGH)
+	secondNormal := pushTestMessage(t, q, "second normal")
+	// Check higher priorities jump the queue, but otherwise retain order of arrival
+	checkOrder(t, q, urgent.Id, high.Id, secondHigh.Id, normal.Id, secondNormal.Id)
+	// Check the order survives a restart
+	failOnError(q.Close(), t)
+	q = openTestQueue(t, dir)
+	defer q.Close()
+	checkOrder(t, q, urgent.Id, high.Id, secondHigh.Id, normal.Id, secondNormal.Id)
+}
+
+func TestExpire(t *testing.T) {
+	dir := createTestDir(t)
+	defer os.RemoveAll(dir)
+	q := openTestQueue(t, dir)
+	// Push messages with and without a TTL
+	forever := pushTestMessage(t, q, "forever")
+	short, err := q.Push(protos.MessageRequest{
+		From:    "briggySmalls",
+		Payload: &protos.MessageRequest_Text{Text: "short"},
+		Ttl:     ptypes.DurationProto(time.Minute),
+	})
+	failOnError(err, t)
+	long, err := q.Push(protos.MessageRequest{
+		From:    "briggySmalls",
+		Payload: &protos.MessageRequest_Text{Text: "long"},
+		Ttl:     ptypes.DurationProto(time.Hour),
+	})
+	failOnError(err, t)
+	// Check nothing expires early
+	checkExpired(t, q, time.Now(), 0)
+	checkOrder(t, q, forever.Id, short.Id, long.Id)
+	// Check messages expire once their TTL has elapsed
+	checkExpired(t, q, time.Now().Add(2*time.Minute), 1)
+	checkOrder(t, q, forever.Id, long.Id)
+	checkExpired(t, q, time.Now().Add(24*time.Hour), 1)
+	checkOrder(t, q, forever.Id)
+	// Check expired messages stay gone after a restart
+	failOnError(q.Close(), t)
+	q = openTestQueue(t, dir)
+	defer q.Close()
+	checkOrder(t, q, forever.Id)
+}
+
+func TestClear(t *testing.T) {
+	dir := createTestDir(t)
+	defer os.RemoveAll(dir)
+	q := openTestQueue(t, dir)
+	// Push some messages and clear them
+	pushTestMessage(t, q, "first")
+	second := pushTestMessage(t, q, "second")
+	failOnError(q.Clear(), t)
+	if q.Len() != 0 || q.Peek() != nil {
+		t.Fatal("Queue not cleared")
+	}
+	// Check the queue is still empty after a restart
+	failOnError(q.Close(), t)
+	q = openTestQueue(t, dir)
+	defer q.Close()
+	if q.Len() != 0 {
+		t.Fatalf("Unexpected queue length: %d", q.Len())
+	}
+	// Check IDs are not reused
+	if third := pushTestMessage(t, q, "third"); third.Id <= second.Id {
+		t.Errorf("Unexpected ID assigned: %d", third.Id)
+	}
+}
+
+func TestFail(t *testing.T) {
+	dir := createTestDir(t)
+	defer os.RemoveAll(dir)
+	q := openTestQueue(t, dir)
+	// Push some messages and fail them
+	first := pushTestMessage(t, q, "first")
+	second := pushTestMessage(t, q, "second")
+	third := pushTestMessage(t, q, "third")
+	failOnError(q.Fail(third.Id, "bad glyph"), t)
+	failOnError(q.Fail(first.Id, "driver unavailable"), t)
+	checkOrder(t, q, second.Id)
+	// Check the failed messages survive a restart, in the order they failed
+	failOnError(q.Close(), t)
+	q = openTestQueue(t, dir)
+	defer q.Close()
+	checkOrder(t, q, second.Id)
+	failed := q.Failed()
+	if len(failed) != 2 || failed[0].Message.Id != third.Id || failed[1].Message.Id != first.Id {
+		t.Fatalf("Unexpected failed messages: %v", failed)
+	}
+	if failed[0].Error != "bad glyph" {
+		t.Errorf("Unexpected error: %s", failed[0].Error)
+	}
+	// Retry a message, which should go to the back of the queue
+	retried, err := q.Retry(third.Id)
+	failOnError(err, t)
+	if retried.Message.GetText() != "third" {
+		t.Errorf("Unexpected message retried: %s", retried.Message.GetText())
+	}
+	checkOrder(t, q, second.Id, retried.Id)
+	// Forget the other message
+	failOnError(q.Discard(first.Id), t)
+	if len(q.Failed()) != 0 {
+		t.Errorf("Unexpected number of failed messages: %d", len(q.Failed()))
+	}
+	// Check missing messages are reported
+	if q.Fail(first.Id, "missing") != ErrMessageNotFound {
+		t.Error("Failing missing message did not fail")
+	}
+	if _, err := q.Retry(first.Id); err != ErrMessageNotFound {
+		t.Error("Retrying missing message did not fail")
+	}
+	if q.Discard(first.Id) != ErrMessageNotFound {
+		t.Error("Discarding missing message did not fail")
+	}
+}
+
+// Helper function to check the number of messages that expire at a given time
+func checkExpired(t *testing.T, q MessageQueue, now time.Time, count int) {
+	expired, err := q.Expire(now)
+	failOnError(err, t)
+	if expired != count {
+		t.Errorf("Unexpected number of messages expired: %d", expired)
+	}
+}
+
+// Helper function to check the order of messages in the queue
+func checkOrder(t *testing.T, q MessageQueue, ids ...uint64) {
+	messages := q.List()
+	if len(messages) != len(ids) {
+		t.Fatalf("Unexpected queue length: %d", len(messages))
+	}
+	for i, message := range messages {
+		if message.Id != ids[i] {
+			t.Errorf("Unexpected message %d at position %d", message.Id, i)
+		}
+	}
+}
+
+// Helper function to create a temporary directory for the database
+func createTestDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "queue")
+	failOnError(err, t)
+	return dir
+}
+
+// Helper function to open a queue in the specified directory
+func openTestQueue(t *testing.T, dir string) MessageQueue {
+	q, err := NewMessageQueue(filepath.Join(dir, "queue.db"))
+	failOnError(err, t)
+	return q
+}
+
+// Helper function to push a text message
+func pushTestMessage(t *testing.T, q MessageQueue, text string) *protos.QueuedMessage {
+	return pushPriorityTestMessage(t, q, text, protos.MessageRequest_NORMAL)
+}
+
+// Helper function to push a text message with the specified priority
+func pushPriorityTestMessage(t *testing.T, q MessageQueue, text string, priority protos.MessageRequest_Priority) *protos.QueuedMessage {
+	message, err := q.Push(protos.MessageRequest{
+		From:     "briggySmalls",
+		Payload:  &protos.MessageRequest_Text{Text: text},
+		Priority: priority,
+	})
+	failOnError(err, t)
+	return message
+}
+
+// Helper function to stop a test in the event of an error
+func failOnError(err error, t *testing.T) {
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,55 @@
+package schedule
+
+import (
+	"fmt"
+	"time"
+)
+
+// Layout of times of day in configuration
+const timeOfDayLayout = "15:04"
+
+// A period of each day, which may span midnight
+type Period struct {
+	// Offset from midnight at which the period starts
+	Start time.Duration
+	// Offset from midnight at which the period ends
+	End time.Duration
+}
+
+// Create a period from a pair of times of day, formatted as "HH:MM"
+func ParsePeriod(start, end string) (period *Period, err error) {
+	startTime, err := parseTimeOfDay(start)
+	if err != nil {
+		return
+	}
+	endTime, err := parseTimeOfDay(end)
+	if err != nil {
+		return
+	}
+	if startTime == endTime {
+		return nil, fmt.Errorf("Period cannot start and end at the same time: %s", start)
+	}
+	period = &Period{Start: startTime, End: endTime}
+	return
+}
+
+// Check if the specified time falls within the period
+func (p *Period) Contains(t time.Time) bool {
+	timeOfDay := time.Duration(t.Hour())*time.Hour +
+		time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+	if p.Start < p.End {
+		return timeOfDay >= p.Start && timeOfDay < p.End
+	}
+	// The period spans midnight
+	return timeOfDay >= p.Start || timeOfDay < p.End
+}
+
+// Parse a time of day into an offset from midnight
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse(timeOfDayLayout, value)
+	if err != nil {
+		return 0, fmt.Errorf("Time of day must be formatted as HH:MM: %s", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
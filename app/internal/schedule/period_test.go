@@ -0,0 +1,57 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePeriod(t *testing.T) {
+	// Prepare test table
+	tables := []struct {
+		start   string
+		end     string
+		isValid bool
+	}{
+		{"07:00", "23:30", true},
+		{"23:00", "07:00", true},
+		{"7am", "23:30", false},
+		{"07:00", "24:00", false},
+		{"07:00", "07:00", false},
+	}
+	for _, table := range tables {
+		_, err := ParsePeriod(table.start, table.end)
+		if (err == nil) != table.isValid {
+			t.Errorf("Unexpected parse result for %s-%s: %v", table.start, table.end, err)
+		}
+	}
+}
+
+func TestContains(t *testing.T) {
+	day, err := ParsePeriod("07:00", "23:30")
+	failOnError(err, t)
+	night, err := ParsePeriod("23:00", "07:00")
+	failOnError(err, t)
+	// Prepare test table
+	tables := []struct {
+		period      *Period
+		hour        int
+		minute      int
+		isContained bool
+	}{
+		{day, 6, 59, false},
+		{day, 7, 0, true},
+		{day, 12, 0, true},
+		{day, 23, 30, false},
+		{night, 22, 59, false},
+		{night, 23, 0, true},
+		{night, 0, 0, true},
+		{night, 6, 59, true},
+		{night, 7, 0, false},
+	}
+	for _, table := range tables {
+		now := time.Date(2019, time.June, 1, table.hour, table.minute, 0, 0, time.Local)
+		if table.period.Contains(now) != table.isContained {
+			t.Errorf("Unexpected result for %02d:%02d in %v", table.hour, table.minute, *table.period)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package schedule
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/briggySmalls/flipdot/app/internal/protos"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/robfig/cron"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	schedulesBucket = []byte("schedules")
+)
+
+// Time to wait for another process to release the database
+const openTimeout = time.Second
+
+// Error returned when a schedule does not exist
+var ErrScheduleNotFound = errors.New("Schedule not found")
+
+type Scheduler interface {
+	Add(request protos.ScheduleRequest) (*protos.ScheduledMessage, error)
+	Cancel(id uint64) error
+	List() []*protos.ScheduledMessage
+	Due(now time.Time) ([]protos.MessageRequest, error)
+	Close() error
+}
+
+type scheduler struct {
+	// Database used to persist schedules
+	db *bolt.DB
+	// In-memory copy of the persisted schedules
+	schedules []*protos.ScheduledMessage
+}
+
+// Creates a scheduler persisted to the specified file, loading any existing schedules
+func NewScheduler(path string) (s Scheduler, err error) {
+	// Open the database, giving up if another process holds on to it
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open schedules %s (is it in use?): %s", path, err)
+	}
+	schdlr := scheduler{db: db}
+	// Load any schedules left over from a previous run
+	err = schdlr.load()
+	if err != nil {
+		db.Close()
+		return
+	}
+	s = &schdlr
+	return
+}
+
+// Check that a request describes a valid schedule
+func Validate(request protos.ScheduleRequest) error {
+	if request.Message == nil {
+		return fmt.Errorf("No message supplied")
+	}
+	switch request.Schedule.(type) {
+	case *protos.ScheduleRequest_DisplayAt:
+		_, err := ptypes.Timestamp(request.GetDisplayAt())
+		return err
+	case *protos.ScheduleRequest_Recurrence:
+		schedule, err := cron.ParseStandard(request.GetRecurrence())
+		if err != nil {
+			return err
+		}
+		// Some valid specs never match a date (e.g. the 30th of February)
+		if schedule.Next(time.Now()).IsZero() {
+			return fmt.Errorf("Recurrence '%s' never occurs", request.GetRecurrence())
+		}
+		return nil
+	default:
+		return fmt.Errorf("Neither display time or recurrence supplied")
+	}
+}
+
+// Add a new schedule
+func (s *scheduler) Add(request protos.ScheduleRequest) (scheduled *protos.ScheduledMessage, err error) {
+	err = Validate(request)
+	if err != nil {
+		return
+	}
+	// Work out when the message is first due
+	next, err := nextTime(request, time.Now())
+	if err != nil {
+		return
+	}
+	if next == nil {
+		return nil, fmt.Errorf("Recurrence '%s' never occurs", request.GetRecurrence())
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(schedulesBucket)
+		// Assign the schedule a unique ID
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		// Record the schedule
+		scheduled = &protos.ScheduledMessage{
+			Id:      id,
+			Request: &request,
+			Next:    next,
+		}
+		return put(bucket, scheduled)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.schedules = append(s.schedules, scheduled)
+	s.sort()
+	return
+}
+
+// Cancel the schedule with the specified ID
+func (s *scheduler) Cancel(id uint64) error {
+	// Find the schedule
+	index := s.find(id)
+	if index < 0 {
+		return ErrScheduleNotFound
+	}
+	// Delete it from disk
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(schedulesBucket).Delete(itob(id))
+	})
+	if err != nil {
+		return err
+	}
+	// Delete it from memory
+	s.schedules = append(s.schedules[:index], s.schedules[index+1:]...)
+	return nil
+}
+
+// Get a copy of the schedules, in order of when they are next due
+func (s *scheduler) List() []*protos.ScheduledMessage {
+	return append([]*protos.ScheduledMessage{}, s.schedules...)
+}
+
+// Get the messages that are due, removing one-off schedules and advancing recurring ones
+func (s *scheduler) Due(now time.Time) (messages []protos.MessageRequest, err error) {
+	// Schedules are sorted, so only the first needs checking to see if any are due
+	if len(s.schedules) == 0 {
+		return
+	}
+	if next, _ := ptypes.Timestamp(s.schedules[0].Next); next.After(now) {
+		return
+	}
+	var remaining []*protos.ScheduledMessage
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(schedulesBucket)
+		for _, scheduled := range s.schedules {
+			next, err := ptypes.Timestamp(scheduled.Next)
+			if err != nil {
+				return err
+			}
+			if next.After(now) {
+				// Not due yet
+				remaining = append(remaining, scheduled)
+				continue
+			}
+			// Release the message
+			messages = append(messages, *scheduled.Request.Message)
+			// Work out when the message is next due
+			updated := *scheduled
+			if scheduled.Request.GetRecurrence() != "" {
+				updated.Next, err = nextTime(*scheduled.Request, now)
+				if err != nil {
+					return err
+				}
+			}
+			if scheduled.Request.GetRecurrence() == "" || updated.Next == nil {
+				// One-off schedules, and recurrences that won't occur again, are finished with
+				err = bucket.Delete(itob(scheduled.Id))
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			err = put(bucket, &updated)
+			if err != nil {
+				return err
+			}
+			remaining = append(remaining, &updated)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.schedules = remaining
+	s.sort()
+	return
+}
+
+// Close the underlying database
+func (s *scheduler) Close() error {
+	return s.db.Close()
+}
+
+// Read all persisted schedules into memory
+func (s *scheduler) load() error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(schedulesBucket)
+		if err != nil {
+			return err
+		}
+		return bucket.ForEach(func(_, value []byte) error {
+			scheduled := protos.ScheduledMessage{}
+			err := proto.Unmarshal(value, &scheduled)
+			if err != nil {
+				return err
+			}
+			s.schedules = append(s.schedules, &scheduled)
+			return nil
+		})
+	})
+	s.sort()
+	return err
+}
+
+// Sort the schedules by when they are next due
+func (s *scheduler) sort() {
+	sort.SliceStable(s.schedules, func(i, j int) bool {
+		iNext, _ := ptypes.Timestamp(s.schedules[i].Next)
+		jNext, _ := ptypes.Timestamp(s.schedules[j].Next)
+		return iNext.Before(jNext)
+	})
+}
+
+// Get the index of the schedule with the specified ID (-1 if not present)
+func (s *scheduler) find(id uint64) int {
+	for i, scheduled := range s.schedules {
+		if scheduled.Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Calculate when a scheduled message is next due after the specified time (nil if never)
+func nextTime(request protos.ScheduleRequest, after time.Time) (*timestamp.Timestamp, error) {
+	var next time.Time
+	if recurrence := request.GetRecurrence(); recurrence != "" {
+		schedule, err := cron.ParseStandard(recurrence)
+		if err != nil {
+			return nil, err
+		}
+		next = schedule.Next(after)
+		if next.IsZero() {
+			return nil, nil
+		}
+	} else {
+		next, _ = ptypes.Timestamp(request.GetDisplayAt())
+	}
+	return ptypes.TimestampProto(next)
+}
+
+// Write a schedule to the bucket
+func put(bucket *bolt.Bucket, scheduled *protos.ScheduledMessage) error {
+	data, err := proto.Marshal(scheduled)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(itob(scheduled.Id), data)
+}
+
+// Convert an ID to a sortable database key
+func itob(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
@@ -0,0 +1,175 @@
+package schedule
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/briggySmalls/flipdot/app/internal/protos"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestValidate(t *testing.T) {
+	message := &protos.MessageRequest{From: "briggySmalls"}
+	// Prepare test table
+	tables := []struct {
+		request protos.ScheduleRequest
+		isValid bool
+	}{
+		{protos.ScheduleRequest{Message: message, Schedule: &protos.ScheduleRequest_DisplayAt{DisplayAt: ptypes.TimestampNow()}}, true},
+		{protos.ScheduleRequest{Message: message, Schedule: &protos.ScheduleRequest_Recurrence{Recurrence: "0 12 * * MON-FRI"}}, true},
+		{protos.ScheduleRequest{Message: message, Schedule: &protos.ScheduleRequest_Recurrence{Recurrence: "not a schedule"}}, false},
+		{protos.ScheduleRequest{Message: message, Schedule: &protos.ScheduleRequest_Recurrence{Recurrence: "0 0 30 2 *"}}, false},
+		{protos.ScheduleRequest{Message: message}, false},
+		{protos.ScheduleRequest{Schedule: &protos.ScheduleRequest_DisplayAt{DisplayAt: ptypes.TimestampNow()}}, false},
+	}
+	for _, table := range tables {
+		err := Validate(table.request)
+		if (err == nil) != table.isValid {
+			t.Errorf("Unexpected validation result for %s: %v", table.request.String(), err)
+		}
+	}
+}
+
+func TestOpenInUse(t *testing.T) {
+	dir := createTestDir(t)
+	defer os.RemoveAll(dir)
+	s := openTestScheduler(t, dir)
+	defer s.Close()
+	// Check opening the schedules again gives up, rather than waiting forever
+	if _, err := NewScheduler(filepath.Join(dir, "schedule.db")); err == nil {
+		t.Error("Schedules in use opened again")
+	}
+}
+
+func TestOneOff(t *testing.T) {
+	dir := createTestDir(t)
+	defer os.RemoveAll(dir)
+	s := openTestScheduler(t, dir)
+	defer s.Close()
+	// Schedule a message in the future
+	displayAt := time.Now().Add(time.Hour)
+	scheduled := addTestSchedule(t, s, protos.ScheduleRequest{
+		Schedule: &protos.ScheduleRequest_DisplayAt{DisplayAt: toTimestamp(t, displayAt)},
+	})
+	// Check the message isn't released early
+	checkDue(t, s, displayAt.Add(-time.Minute), 0)
+	// Check the message is released once due, and only once
+	checkDue(t, s, displayAt, 1)
+	checkDue(t, s, displayAt.Add(time.Hour), 0)
+	// Cancelling the finished schedule should fail
+	if s.Cancel(scheduled.Id) != ErrScheduleNotFound {
+		t.Error("Cancelling finished schedule did not fail")
+	}
+}
+
+func TestRecurring(t *testing.T) {
+	dir := createTestDir(t)
+	defer os.RemoveAll(dir)
+	s := openTestScheduler(t, dir)
+	// Schedule a message every day at midday
+	scheduled := addTestSchedule(t, s, protos.ScheduleRequest{
+		Schedule: &protos.ScheduleRequest_Recurrence{Recurrence: "0 12 * * *"},
+	})
+	next, err := ptypes.Timestamp(scheduled.Next)
+	failOnError(err, t)
+	if next.Hour() != 12 || next.Minute() != 0 {
+		t.Errorf("Unexpected next time: %s", next)
+	}
+	// Check the message is released when due, and rescheduled for the next day
+	checkDue(t, s, next, 1)
+	checkDue(t, s, next.Add(time.Hour), 0)
+	checkDue(t, s, next.Add(24*time.Hour), 1)
+	// Check the schedule survives a restart
+	failOnError(s.Close(), t)
+	s = openTestScheduler(t, dir)
+	defer s.Close()
+	schedules := s.List()
+	if len(schedules) != 1 {
+		t.Fatalf("Unexpected number of schedules: %d", len(schedules))
+	}
+	restoredNext, err := ptypes.Timestamp(schedules[0].Next)
+	failOnError(err, t)
+	if !restoredNext.Equal(next.Add(48 * time.Hour)) {
+		t.Errorf("Unexpected next time: %s", restoredNext)
+	}
+	// Check the schedule can be cancelled
+	failOnError(s.Cancel(scheduled.Id), t)
+	checkDue(t, s, next.Add(72*time.Hour), 0)
+}
+
+func TestRecurrenceNeverOccurs(t *testing.T) {
+	dir := createTestDir(t)
+	defer os.RemoveAll(dir)
+	s := openTestScheduler(t, dir)
+	defer s.Close()
+	// Persist a schedule for the 30th of February, as if it were added before being rejected
+	request := protos.ScheduleRequest{
+		Message:  &protos.MessageRequest{},
+		Schedule: &protos.ScheduleRequest_Recurrence{Recurrence: "0 0 30 2 *"},
+	}
+	scheduled := &protos.ScheduledMessage{Id: 1, Request: &request, Next: toTimestamp(t, time.Now())}
+	schdlr := s.(*scheduler)
+	failOnError(schdlr.db.Update(func(tx *bolt.Tx) error {
+		return put(tx.Bucket(schedulesBucket), scheduled)
+	}), t)
+	schdlr.schedules = append(schdlr.schedules, scheduled)
+	// Check it is released once, then finished with
+	checkDue(t, s, time.Now(), 1)
+	if len(s.List()) != 0 {
+		t.Error("Schedule that never occurs again not removed")
+	}
+	checkDue(t, s, time.Now().Add(time.Hour), 0)
+}
+
+// Helper function to check the number of messages released at a given time
+func checkDue(t *testing.T, s Scheduler, now time.Time, count int) {
+	messages, err := s.Due(now)
+	failOnError(err, t)
+	if len(messages) != count {
+		t.Errorf("Unexpected number of messages due at %s: %d", now, len(messages))
+	}
+}
+
+// Helper function to create a temporary directory for the database
+func createTestDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "schedule")
+	failOnError(err, t)
+	return dir
+}
+
+// Helper function to open a scheduler in the specified directory
+func openTestScheduler(t *testing.T, dir string) Scheduler {
+	s, err := NewScheduler(filepath.Join(dir, "schedule.db"))
+	failOnError(err, t)
+	return s
+}
+
+// Helper function to schedule a text message
+func addTestSchedule(t *testing.T, s Scheduler, request protos.ScheduleRequest) *protos.ScheduledMessage {
+	request.Message = &protos.MessageRequest{
+		From:    "briggySmalls",
+		Payload: &protos.MessageRequest_Text{Text: "test text"},
+	}
+	scheduled, err := s.Add(request)
+	failOnError(err, t)
+	return scheduled
+}
+
+// Helper function to convert a time to a protobuf timestamp
+func toTimestamp(t *testing.T, time time.Time) *timestamp.Timestamp {
+	ts, err := ptypes.TimestampProto(time)
+	failOnError(err, t)
+	return ts
+}
+
+// Helper function to stop a test in the event of an error
+func failOnError(err error, t *testing.T) {
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -3,48 +3,113 @@ package server
 import (
 	context "context"
 	fmt "fmt"
+	"math"
 	"time"
 
 	grpc "google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 
+	"github.com/briggySmalls/flipdot/app/internal/bitmap"
+	"github.com/briggySmalls/flipdot/app/internal/client"
+	"github.com/briggySmalls/flipdot/app/internal/mode"
 	"github.com/briggySmalls/flipdot/app/internal/protos"
+	"github.com/briggySmalls/flipdot/app/internal/queue"
+	"github.com/briggySmalls/flipdot/app/internal/schedule"
 	"github.com/dgrijalva/jwt-go"
+	"github.com/golang/protobuf/ptypes"
 	"google.golang.org/grpc/status"
 )
 
-func NewRpcServer(secret, password string, tokenExpiry time.Duration, messageQueue chan protos.MessageRequest, signsInfo []*protos.GetInfoResponse_SignInfo) (grpcServer *grpc.Server) {
+// Manager of the messages waiting to be displayed
+type QueueManager interface {
+	ListMessages(ctx context.Context) ([]*protos.QueuedMessage, error)
+	DeleteMessage(ctx context.Context, id uint64) error
+	MoveMessage(ctx context.Context, id uint64, position int) error
+	ClearMessages(ctx context.Context) error
+	ListFailedMessages(ctx context.Context) ([]*protos.FailedMessage, error)
+	RetryFailedMessage(ctx context.Context, id uint64) error
+	DeleteFailedMessage(ctx context.Context, id uint64) error
+	ScheduleMessage(ctx context.Context, request protos.ScheduleRequest) (*protos.ScheduledMessage, error)
+	ListSchedules(ctx context.Context) ([]*protos.ScheduledMessage, error)
+	CancelSchedule(ctx context.Context, id uint64) error
+}
+
+// Manager of what is displayed whilst idle
+type ModeManager interface {
+	SetMode(ctx context.Context, name string) error
+	GetMode(ctx context.Context) (name string, available []string, err error)
+	SetPlaylist(ctx context.Context, entries []*protos.Playlist_Entry) error
+	GetPlaylist(ctx context.Context) ([]*protos.Playlist_Entry, error)
+}
+
+// Source of application events
+type EventSource interface {
+	SubscribeEvents() (<-chan *protos.Event, func())
+}
+
+// Controller of the signs themselves
+type SignController interface {
+	Frame() *protos.Frame
+	LightOn() error
+	LightOff() error
+	IsLightOn() bool
+	TestStart() error
+	TestStop() error
+	Health() *protos.DriverHealth
+	FitImages(images []*protos.Image) ([]*protos.Image, error)
+	Capabilities() []protos.GetInfoResponse_Capability
+	Version() string
+}
+
+func NewRpcServer(ctx context.Context, secret, password string, tokenExpiry time.Duration, messageQueue chan protos.MessageRequest, queueManager QueueManager, modeManager ModeManager, eventSource EventSource, signController SignController, signsInfo []*protos.GetInfoResponse_SignInfo) (grpcServer *grpc.Server) {
 	// Create a flipdot server
-	server := NewServer(secret, password, tokenExpiry, messageQueue, signsInfo)
+	server := NewServer(ctx, secret, password, tokenExpiry, messageQueue, queueManager, modeManager, eventSource, signController, signsInfo)
 	// create a gRPC server object
-	grpcServer = grpc.NewServer(grpc.UnaryInterceptor(server.(*appServer).unaryAuthInterceptor))
+	grpcServer = grpc.NewServer(
+		grpc.UnaryInterceptor(server.(*appServer).unaryAuthInterceptor),
+		grpc.StreamInterceptor(server.(*appServer).streamAuthInterceptor))
 	// attach the App service to the server
 	protos.RegisterAppServer(grpcServer, server)
 	return grpcServer
 }
 
-// Create a new server
-func NewServer(secret, password string, tokenExpiry time.Duration, messageQueue chan protos.MessageRequest, signsInfo []*protos.GetInfoResponse_SignInfo) protos.AppServer {
+// Create a new server, whose streams end when the context is cancelled (on shutdown)
+func NewServer(ctx context.Context, secret, password string, tokenExpiry time.Duration, messageQueue chan protos.MessageRequest, queueManager QueueManager, modeManager ModeManager, eventSource EventSource, signController SignController, signsInfo []*protos.GetInfoResponse_SignInfo) protos.AppServer {
 	// Create a flipdot controller
 	server := &appServer{
-		appSecret:    secret,
-		appPassword:  password,
-		tokenExpiry:  tokenExpiry,
-		messageQueue: messageQueue,
-		signsInfo:    signsInfo,
+		ctx:            ctx,
+		appSecret:      secret,
+		appPassword:    password,
+		tokenExpiry:    tokenExpiry,
+		messageQueue:   messageQueue,
+		queueManager:   queueManager,
+		modeManager:    modeManager,
+		eventSource:    eventSource,
+		signController: signController,
+		signsInfo:      signsInfo,
 	}
 	// Return the server
 	return server
 }
 
 type appServer struct {
+	// Context cancelled when the application shuts down
+	ctx         context.Context
 	appSecret   string
 	appPassword string
 	// Time after which an authorisation token expires
 	tokenExpiry time.Duration
 	// Channel to which new messages are sent
 	messageQueue chan protos.MessageRequest
+	// Manager of messages already in the queue
+	queueManager QueueManager
+	// Manager of what is displayed whilst idle
+	modeManager ModeManager
+	// Source of events to stream to clients
+	eventSource EventSource
+	// Source of the images displayed on the signs
+	signController SignController
 	// Information on connected signs
 	signsInfo []*protos.GetInfoResponse_SignInfo
 }
@@ -71,16 +136,41 @@ func (f *appServer) Authenticate(_ context.Context, request *protos.Authenticate
 func (f *appServer) GetInfo(_ context.Context, _ *protos.GetInfoRequest) (*protos.GetInfoResponse, error) {
 	// Make a request to the controller
 	signs := f.signsInfo
-	response := protos.GetInfoResponse{Signs: signs}
+	response := protos.GetInfoResponse{
+		Signs:        signs,
+		Capabilities: f.signController.Capabilities(),
+		Version:      f.signController.Version(),
+	}
 	return &response, nil
 }
 
 // Handler for client request to display a message
 func (f *appServer) SendMessage(ctx context.Context, request *protos.MessageRequest) (response *protos.MessageResponse, err error) {
+	// Check the priority is one we understand
+	if _, ok := protos.MessageRequest_Priority_name[int32(request.Priority)]; !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "Unknown priority: %d", request.Priority)
+	}
+	// Check the time-to-live makes sense, if supplied
+	if request.Ttl != nil {
+		if ttl, err := ptypes.Duration(request.Ttl); err != nil || ttl <= 0 {
+			return nil, status.Error(codes.InvalidArgument, "Time-to-live must be positive")
+		}
+	}
+	// Check the images suit the signs
+	err = f.fitImages(request)
+	if err != nil {
+		return nil, err
+	}
 	switch request.Payload.(type) {
 	case *protos.MessageRequest_Images, *protos.MessageRequest_Text:
-		// Enqueue message
-		f.messageQueue <- *request
+		// Enqueue message, unless the caller gives up or the application stops first
+		select {
+		case f.messageQueue <- *request:
+		case <-ctx.Done():
+			return nil, waitError(ctx.Err())
+		case <-f.ctx.Done():
+			return nil, status.Error(codes.Unavailable, "Server shutting down")
+		}
 	default:
 		err = status.Error(codes.InvalidArgument, "Neither images or text supplied")
 	}
@@ -88,6 +178,301 @@ func (f *appServer) SendMessage(ctx context.Context, request *protos.MessageRequ
 	return
 }
 
+// Handler for client request to list the messages waiting to be displayed
+func (f *appServer) ListMessages(ctx context.Context, _ *protos.ListMessagesRequest) (*protos.ListMessagesResponse, error) {
+	messages, err := f.queueManager.ListMessages(ctx)
+	if err != nil {
+		return nil, queueError(err)
+	}
+	return &protos.ListMessagesResponse{Messages: messages}, nil
+}
+
+// Handler for client request to delete a pending message
+func (f *appServer) DeleteMessage(ctx context.Context, request *protos.DeleteMessageRequest) (*protos.DeleteMessageResponse, error) {
+	err := f.queueManager.DeleteMessage(ctx, request.Id)
+	if err != nil {
+		return nil, queueError(err)
+	}
+	return &protos.DeleteMessageResponse{}, nil
+}
+
+// Handler for client request to move a pending message within the queue
+func (f *appServer) MoveMessage(ctx context.Context, request *protos.MoveMessageRequest) (*protos.MoveMessageResponse, error) {
+	// Positions past the back of the queue are moved to the back, so clamp before ints can overflow
+	position := request.Position
+	if position > math.MaxInt32 {
+		position = math.MaxInt32
+	}
+	err := f.queueManager.MoveMessage(ctx, request.Id, int(position))
+	if err != nil {
+		return nil, queueError(err)
+	}
+	return &protos.MoveMessageResponse{}, nil
+}
+
+// Handler for client request to delete all pending messages
+func (f *appServer) ClearMessages(ctx context.Context, _ *protos.ClearMessagesRequest) (*protos.ClearMessagesResponse, error) {
+	err := f.queueManager.ClearMessages(ctx)
+	if err != nil {
+		return nil, queueError(err)
+	}
+	return &protos.ClearMessagesResponse{}, nil
+}
+
+// Handler for client request to list the messages that could not be displayed
+func (f *appServer) ListFailedMessages(ctx context.Context, _ *protos.ListFailedMessagesRequest) (*protos.ListFailedMessagesResponse, error) {
+	messages, err := f.queueManager.ListFailedMessages(ctx)
+	if err != nil {
+		return nil, queueError(err)
+	}
+	return &protos.ListFailedMessagesResponse{Messages: messages}, nil
+}
+
+// Handler for client request to queue a message that could not be displayed again
+func (f *appServer) RetryFailedMessage(ctx context.Context, request *protos.RetryFailedMessageRequest) (*protos.RetryFailedMessageResponse, error) {
+	err := f.queueManager.RetryFailedMessage(ctx, request.Id)
+	if err != nil {
+		return nil, queueError(err)
+	}
+	return &protos.RetryFailedMessageResponse{}, nil
+}
+
+// Handler for client request to forget a message that could not be displayed
+func (f *appServer) DeleteFailedMessage(ctx context.Context, request *protos.DeleteFailedMessageRequest) (*protos.DeleteFailedMessageResponse, error) {
+	err := f.queueManager.DeleteFailedMessage(ctx, request.Id)
+	if err != nil {
+		return nil, queueError(err)
+	}
+	return &protos.DeleteFailedMessageResponse{}, nil
+}
+
+// Handler for client request to display a message at a later time
+func (f *appServer) ScheduleMessage(ctx context.Context, request *protos.ScheduleRequest) (*protos.ScheduleResponse, error) {
+	// Check the request before passing it on
+	err := schedule.Validate(*request)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	err = f.fitImages(request.Message)
+	if err != nil {
+		return nil, err
+	}
+	scheduled, err := f.queueManager.ScheduleMessage(ctx, *request)
+	if err != nil {
+		return nil, queueError(err)
+	}
+	return &protos.ScheduleResponse{Id: scheduled.Id}, nil
+}
+
+// Handler for client request to list the messages waiting to be released into the queue
+func (f *appServer) ListSchedules(ctx context.Context, _ *protos.ListSchedulesRequest) (*protos.ListSchedulesResponse, error) {
+	schedules, err := f.queueManager.ListSchedules(ctx)
+	if err != nil {
+		return nil, queueError(err)
+	}
+	return &protos.ListSchedulesResponse{Schedules: schedules}, nil
+}
+
+// Handler for client request to cancel a scheduled message
+func (f *appServer) CancelSchedule(ctx context.Context, request *protos.CancelScheduleRequest) (*protos.CancelScheduleResponse, error) {
+	err := f.queueManager.CancelSchedule(ctx, request.Id)
+	if err != nil {
+		return nil, queueError(err)
+	}
+	return &protos.CancelScheduleResponse{}, nil
+}
+
+// Handler for client request of the mode displayed whilst idle
+func (f *appServer) GetMode(ctx context.Context, _ *protos.GetModeRequest) (*protos.GetModeResponse, error) {
+	name, available, err := f.modeManager.GetMode(ctx)
+	if err != nil {
+		return nil, waitError(err)
+	}
+	return &protos.GetModeResponse{Name: name, Available: available}, nil
+}
+
+// Handler for client request to change the mode displayed whilst idle
+func (f *appServer) SetMode(ctx context.Context, request *protos.SetModeRequest) (*protos.SetModeResponse, error) {
+	err := f.modeManager.SetMode(ctx, request.Name)
+	if waitErr := waitError(err); waitErr != nil {
+		return nil, waitErr
+	} else if err == mode.ErrModeNotFound {
+		return nil, status.Errorf(codes.NotFound, "Unknown mode: %s", request.Name)
+	} else if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &protos.SetModeResponse{}, nil
+}
+
+// Handler for client request of the modes rotated through whilst idle
+func (f *appServer) GetPlaylist(ctx context.Context, _ *protos.GetPlaylistRequest) (*protos.Playlist, error) {
+	entries, err := f.modeManager.GetPlaylist(ctx)
+	if err != nil {
+		return nil, waitError(err)
+	}
+	return &protos.Playlist{Entries: entries}, nil
+}
+
+// Handler for client request to replace the modes rotated through whilst idle
+func (f *appServer) SetPlaylist(ctx context.Context, request *protos.Playlist) (*protos.SetPlaylistResponse, error) {
+	err := f.modeManager.SetPlaylist(ctx, request.Entries)
+	if waitErr := waitError(err); waitErr != nil {
+		return nil, waitErr
+	} else if err == mode.ErrModeNotFound {
+		return nil, status.Error(codes.NotFound, "Playlist contains unknown mode")
+	} else if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return &protos.SetPlaylistResponse{}, nil
+}
+
+// Handler for client request to stream application events
+func (f *appServer) GetEvents(_ *protos.EventsRequest, stream protos.App_GetEventsServer) error {
+	events, unsubscribe := f.eventSource.SubscribeEvents()
+	defer unsubscribe()
+	for {
+		select {
+		case event := <-events:
+			// Forward the event to the client
+			err := stream.Send(event)
+			if err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			// Client has gone away
+			return nil
+		case <-f.ctx.Done():
+			// We are shutting down
+			return status.Error(codes.Unavailable, "Server shutting down")
+		}
+	}
+}
+
+// Handler for client request of the images currently displayed
+func (f *appServer) GetFrame(_ context.Context, request *protos.FrameRequest) (*protos.Frame, error) {
+	return f.encodeFrame(f.signController.Frame(), request.Packed)
+}
+
+// Handler for client request to stream the images displayed, as they change
+func (f *appServer) GetFrameUpdates(request *protos.FrameRequest, stream protos.App_GetFrameUpdatesServer) error {
+	events, unsubscribe := f.eventSource.SubscribeEvents()
+	defer unsubscribe()
+	// Start the client off with what is currently displayed
+	frame, err := f.encodeFrame(f.signController.Frame(), request.Packed)
+	if err != nil {
+		return err
+	}
+	err = stream.Send(frame)
+	if err != nil {
+		return err
+	}
+	for {
+		select {
+		case event := <-events:
+			// Forward any new frames to the client
+			if frame := event.GetFrameDrawn(); frame != nil {
+				frame, err := f.encodeFrame(frame, request.Packed)
+				if err != nil {
+					return err
+				}
+				err = stream.Send(frame)
+				if err != nil {
+					return err
+				}
+			}
+		case <-stream.Context().Done():
+			// Client has gone away
+			return nil
+		case <-f.ctx.Done():
+			// We are shutting down
+			return status.Error(codes.Unavailable, "Server shutting down")
+		}
+	}
+}
+
+// Helper function to check a message's images suit the signs, replacing them with any cropped or padded versions
+func (f *appServer) fitImages(request *protos.MessageRequest) error {
+	images := request.GetImages()
+	if images == nil {
+		return nil
+	}
+	fitted, err := f.signController.FitImages(images.Images)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	request.Payload = &protos.MessageRequest_Images{Images: &protos.Images{Images: fitted}}
+	return nil
+}
+
+// Helper function to pack a frame's images into bitmaps, if the client asked for them
+func (f *appServer) encodeFrame(frame *protos.Frame, packed bool) (*protos.Frame, error) {
+	if !packed {
+		return frame, nil
+	}
+	encoded := protos.Frame{}
+	for _, signImage := range frame.Signs {
+		var sign *protos.GetInfoResponse_SignInfo
+		for _, info := range f.signsInfo {
+			if info.Name == signImage.Sign {
+				sign = info
+			}
+		}
+		if sign == nil {
+			return nil, status.Errorf(codes.Internal, "Frame has unknown sign: %s", signImage.Sign)
+		}
+		image, err := bitmap.Packed(signImage.Image, uint(sign.Width), uint(sign.Height))
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "Failed to pack image for %s: %s", sign.Name, err)
+		}
+		encoded.Signs = append(encoded.Signs, &protos.Frame_SignImage{Sign: signImage.Sign, Image: image})
+	}
+	return &encoded, nil
+}
+
+// Handler for client request to start or stop the test sequence
+func (f *appServer) Test(_ context.Context, request *protos.TestRequest) (*protos.TestResponse, error) {
+	var err error
+	switch request.Action {
+	case protos.TestRequest_START:
+		err = f.signController.TestStart()
+	case protos.TestRequest_STOP:
+		err = f.signController.TestStop()
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "Unknown test action: %s", request.Action)
+	}
+	if err != nil {
+		return nil, driverError(err)
+	}
+	return &protos.TestResponse{}, nil
+}
+
+// Handler for client request to turn the light on or off
+func (f *appServer) Light(_ context.Context, request *protos.LightRequest) (*protos.LightResponse, error) {
+	var err error
+	switch request.Status {
+	case protos.LightRequest_ON:
+		err = f.signController.LightOn()
+	case protos.LightRequest_OFF:
+		err = f.signController.LightOff()
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "Unknown light status: %s", request.Status)
+	}
+	if err != nil {
+		return nil, driverError(err)
+	}
+	return &protos.LightResponse{}, nil
+}
+
+// Handler for client request of whether the light is on
+func (f *appServer) GetLight(_ context.Context, _ *protos.GetLightRequest) (*protos.GetLightResponse, error) {
+	return &protos.GetLightResponse{On: f.signController.IsLightOn()}, nil
+}
+
+// Handler for client request of whether the driver can be reached
+func (f *appServer) GetDriverHealth(_ context.Context, _ *protos.GetDriverHealthRequest) (*protos.DriverHealth, error) {
+	return f.signController.Health(), nil
+}
+
 // Interceptor that checks all RPC calls are authorized
 func (f *appServer) unaryAuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 	// First, check this isn't an auth call itself
@@ -95,22 +480,39 @@ func (f *appServer) unaryAuthInterceptor(ctx context.Context, req interface{}, i
 		// We don't need to check for tokens here
 		return handler(ctx, req)
 	}
+	// Check the caller is authorised
+	err := f.authorise(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Execute the usual RPC clal
+	return handler(ctx, req)
+}
+
+// Interceptor that checks all streaming RPC calls are authorized
+func (f *appServer) streamAuthInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	// Check the caller is authorised
+	err := f.authorise(stream.Context())
+	if err != nil {
+		return err
+	}
+	// Execute the usual RPC call
+	return handler(srv, stream)
+}
+
+// Helper function to check the token in a request's metadata
+func (f *appServer) authorise(ctx context.Context) error {
 	// Try to pull out token from metadata
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
 		// Caller didn't supply a token
-		return nil, status.Error(codes.Unauthenticated, "Authentication token not provided")
+		return status.Error(codes.Unauthenticated, "Authentication token not provided")
 	}
 	if len(md["token"]) == 0 {
-		return nil, status.Error(codes.InvalidArgument, "Badly formatted metadata (missing token)")
+		return status.Error(codes.InvalidArgument, "Badly formatted metadata (missing token)")
 	}
 	// Check the token
-	err := f.checkToken(md["token"][0])
-	if err != nil {
-		return nil, err
-	}
-	// Execute the usual RPC clal
-	return handler(ctx, req)
+	return f.checkToken(md["token"][0])
 }
 
 // Helper function to check a request's JWT token is valid
@@ -130,3 +532,34 @@ func (f *appServer) checkToken(t string) error {
 	}
 	return nil
 }
+
+// Helper function to convert a queue error to a gRPC status
+func queueError(err error) error {
+	if waitErr := waitError(err); waitErr != nil {
+		return waitErr
+	}
+	if err == queue.ErrMessageNotFound || err == schedule.ErrScheduleNotFound {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return status.Errorf(codes.Internal, "Failed to update queue: %s", err)
+}
+
+// Helper function to convert an error from waiting on the application to a gRPC status (nil if it isn't one)
+func waitError(err error) error {
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return status.FromContextError(err).Err()
+	}
+	if _, ok := status.FromError(err); ok {
+		// Already a status, such as the application having stopped
+		return err
+	}
+	return nil
+}
+
+// Helper function to convert a sign controller error to a gRPC status
+func driverError(err error) error {
+	if err == client.ErrUnsupported {
+		return status.Error(codes.Unimplemented, err.Error())
+	}
+	return status.Error(codes.Unavailable, err.Error())
+}
@@ -2,11 +2,20 @@ package server
 
 import (
 	context "context"
+	"fmt"
+	"math"
 	reflect "reflect"
 	"testing"
 	"time"
 
+	"github.com/briggySmalls/flipdot/app/internal/bitmap"
+	"github.com/briggySmalls/flipdot/app/internal/client"
+	"github.com/briggySmalls/flipdot/app/internal/mode"
 	"github.com/briggySmalls/flipdot/app/internal/protos"
+	"github.com/briggySmalls/flipdot/app/internal/queue"
+	"github.com/briggySmalls/flipdot/app/internal/schedule"
+	"github.com/golang/mock/gomock"
+	"github.com/golang/protobuf/ptypes"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -56,7 +65,15 @@ func TestAuthenticatePass(t *testing.T) {
 }
 
 func TestGetInfo(t *testing.T) {
-	flipapps, queue, signs := createTestObjects(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	controller := NewMockSignController(ctrl)
+	signs := []*protos.GetInfoResponse_SignInfo{{Name: "test1", Width: 10, Height: 2}}
+	flipapps := NewServer(context.Background(), "secret", "password", time.Hour, make(chan protos.MessageRequest), nil, nil, nil, controller, signs)
+	// Configure the controller to report the driver's capabilities
+	capabilities := []protos.GetInfoResponse_Capability{protos.GetInfoResponse_TEST}
+	controller.EXPECT().Capabilities().Return(capabilities)
+	controller.EXPECT().Version().Return("1.2.3")
 	// Run the command
 	ctx, cancel := getContext()
 	defer cancel()
@@ -69,8 +86,9 @@ func TestGetInfo(t *testing.T) {
 	if !reflect.DeepEqual(response.Signs, signs) {
 		t.Errorf("Signs don't match")
 	}
-	// Check no messages were sent
-	checkNoMessages(t, queue)
+	if !reflect.DeepEqual(response.Capabilities, capabilities) || response.Version != "1.2.3" {
+		t.Errorf("Unexpected driver information: %s", response.String())
+	}
 }
 
 func TestSendMessage(t *testing.T) {
@@ -81,7 +99,7 @@ func TestSendMessage(t *testing.T) {
 	defer cancel()
 	originalRequest := protos.MessageRequest{
 		From:    "briggySmalls",
-		Payload: &protos.MessageRequest_Text{"test text"},
+		Payload: &protos.MessageRequest_Text{Text: "test text"},
 	}
 	_, err := flipapps.SendMessage(ctx, &originalRequest)
 	// Assert the return values
@@ -99,6 +117,492 @@ func TestSendMessage(t *testing.T) {
 	}
 }
 
+func TestSendMessageGivesUp(t *testing.T) {
+	request := &protos.MessageRequest{
+		From:    "briggySmalls",
+		Payload: &protos.MessageRequest_Text{Text: "test text"},
+	}
+	// Check the caller giving up is reported, with nothing taking messages
+	flipapps := NewServer(context.Background(), "secret", "password", time.Hour, make(chan protos.MessageRequest), nil, nil, nil, nil, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := flipapps.SendMessage(ctx, request); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	// Check the application stopping is reported
+	shutdown, stop := context.WithCancel(context.Background())
+	stop()
+	flipapps = NewServer(shutdown, "secret", "password", time.Hour, make(chan protos.MessageRequest), nil, nil, nil, nil, nil)
+	if _, err := flipapps.SendMessage(context.Background(), request); status.Code(err) != codes.Unavailable {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestSendMessageInvalidTtl(t *testing.T) {
+	flipapps, queue, _ := createTestObjects(t)
+	// Run the command with a negative time-to-live
+	ctx, cancel := getContext()
+	defer cancel()
+	_, err := flipapps.SendMessage(ctx, &protos.MessageRequest{
+		From:    "briggySmalls",
+		Payload: &protos.MessageRequest_Text{Text: "test text"},
+		Ttl:     ptypes.DurationProto(-time.Minute),
+	})
+	if s, ok := status.FromError(err); !ok || s.Code() != codes.InvalidArgument {
+		t.Errorf("Failed to assign appropriate error code: %s", s.Code())
+	}
+	// Check no messages were sent
+	checkNoMessages(t, queue)
+}
+
+func TestSendMessageImages(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	controller := NewMockSignController(ctrl)
+	queue := make(chan protos.MessageRequest, 1)
+	flipapps := NewServer(context.Background(), "secret", "password", time.Hour, queue, nil, nil, nil, controller, nil)
+	// Expect the first images to be fitted to the signs, and the second rejected
+	images := []*protos.Image{{Bitmap: &protos.Bitmap{Width: 1, Height: 1, Data: []byte{0x80}}}}
+	fitted := []*protos.Image{{Data: []bool{true, false}}}
+	gomock.InOrder(
+		controller.EXPECT().FitImages(images).Return(fitted, nil),
+		controller.EXPECT().FitImages(images).Return(nil, fmt.Errorf("Image 0 is 1x1, expected 2x1")),
+	)
+	request := func() *protos.MessageRequest {
+		return &protos.MessageRequest{
+			From:    "briggySmalls",
+			Payload: &protos.MessageRequest_Images{Images: &protos.Images{Images: images}},
+		}
+	}
+	_, err := flipapps.SendMessage(context.Background(), request())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message := <-queue; !reflect.DeepEqual(message.GetImages().Images, fitted) {
+		t.Errorf("Unexpected images: %v", message.GetImages().Images)
+	}
+	_, err = flipapps.SendMessage(context.Background(), request())
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	// Check no messages were sent
+	checkNoMessages(t, queue)
+}
+
+func TestListMessages(t *testing.T) {
+	ctrl, flipapps, manager := createQueueTestObjects(t)
+	defer ctrl.Finish()
+	// Configure the mock to return some messages
+	messages := []*protos.QueuedMessage{
+		{Id: 1, Message: &protos.MessageRequest{From: "briggySmalls"}},
+		{Id: 2, Message: &protos.MessageRequest{From: "briggySmalls"}},
+	}
+	manager.EXPECT().ListMessages(gomock.Any()).Return(messages, nil)
+	// Run the command
+	ctx, cancel := getContext()
+	defer cancel()
+	response, err := flipapps.ListMessages(ctx, &protos.ListMessagesRequest{})
+	// Assert the return values
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(response.Messages, messages) {
+		t.Errorf("Messages don't match")
+	}
+}
+
+func TestDeleteMessage(t *testing.T) {
+	ctrl, flipapps, manager := createQueueTestObjects(t)
+	defer ctrl.Finish()
+	// Expect the message to be deleted
+	manager.EXPECT().DeleteMessage(gomock.Any(), uint64(3)).Return(nil)
+	// Run the command
+	ctx, cancel := getContext()
+	defer cancel()
+	_, err := flipapps.DeleteMessage(ctx, &protos.DeleteMessageRequest{Id: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeleteMissingMessage(t *testing.T) {
+	ctrl, flipapps, manager := createQueueTestObjects(t)
+	defer ctrl.Finish()
+	// Report that the message isn't present
+	manager.EXPECT().DeleteMessage(gomock.Any(), uint64(3)).Return(queue.ErrMessageNotFound)
+	// Run the command
+	ctx, cancel := getContext()
+	defer cancel()
+	_, err := flipapps.DeleteMessage(ctx, &protos.DeleteMessageRequest{Id: 3})
+	if s, ok := status.FromError(err); !ok || s.Code() != codes.NotFound {
+		t.Errorf("Failed to assign appropriate error code: %s", s.Code())
+	}
+}
+
+func TestMoveMessage(t *testing.T) {
+	ctrl, flipapps, manager := createQueueTestObjects(t)
+	defer ctrl.Finish()
+	// Expect the message to be moved
+	manager.EXPECT().MoveMessage(gomock.Any(), uint64(3), 0).Return(nil)
+	// Run the command
+	ctx, cancel := getContext()
+	defer cancel()
+	_, err := flipapps.MoveMessage(ctx, &protos.MoveMessageRequest{Id: 3, Position: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Check positions too large for an int on 32-bit platforms aren't passed on negative
+	manager.EXPECT().MoveMessage(gomock.Any(), uint64(3), math.MaxInt32).Return(nil)
+	_, err = flipapps.MoveMessage(ctx, &protos.MoveMessageRequest{Id: 3, Position: math.MaxUint32})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClearMessages(t *testing.T) {
+	ctrl, flipapps, manager := createQueueTestObjects(t)
+	defer ctrl.Finish()
+	// Expect the queue to be cleared
+	manager.EXPECT().ClearMessages(gomock.Any()).Return(nil)
+	// Run the command
+	ctx, cancel := getContext()
+	defer cancel()
+	_, err := flipapps.ClearMessages(ctx, &protos.ClearMessagesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScheduleMessage(t *testing.T) {
+	ctrl, flipapps, manager := createQueueTestObjects(t)
+	defer ctrl.Finish()
+	// Expect the message to be scheduled
+	request := protos.ScheduleRequest{
+		Message: &protos.MessageRequest{
+			From:    "briggySmalls",
+			Payload: &protos.MessageRequest_Text{Text: "test text"},
+		},
+		Schedule: &protos.ScheduleRequest_Recurrence{Recurrence: "0 12 * * *"},
+	}
+	manager.EXPECT().ScheduleMessage(gomock.Any(), request).Return(&protos.ScheduledMessage{Id: 4}, nil)
+	// Run the command
+	ctx, cancel := getContext()
+	defer cancel()
+	response, err := flipapps.ScheduleMessage(ctx, &request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Id != 4 {
+		t.Errorf("Unexpected schedule ID: %d", response.Id)
+	}
+}
+
+func TestScheduleMessageInvalid(t *testing.T) {
+	ctrl, flipapps, _ := createQueueTestObjects(t)
+	defer ctrl.Finish()
+	// Run the command with a bad recurrence (mock expects no calls)
+	ctx, cancel := getContext()
+	defer cancel()
+	_, err := flipapps.ScheduleMessage(ctx, &protos.ScheduleRequest{
+		Message:  &protos.MessageRequest{From: "briggySmalls"},
+		Schedule: &protos.ScheduleRequest_Recurrence{Recurrence: "sometimes"},
+	})
+	if s, ok := status.FromError(err); !ok || s.Code() != codes.InvalidArgument {
+		t.Errorf("Failed to assign appropriate error code: %s", s.Code())
+	}
+}
+
+func TestCancelSchedule(t *testing.T) {
+	ctrl, flipapps, manager := createQueueTestObjects(t)
+	defer ctrl.Finish()
+	// Report that the schedule isn't present
+	manager.EXPECT().CancelSchedule(gomock.Any(), uint64(4)).Return(schedule.ErrScheduleNotFound)
+	// Run the command
+	ctx, cancel := getContext()
+	defer cancel()
+	_, err := flipapps.CancelSchedule(ctx, &protos.CancelScheduleRequest{Id: 4})
+	if s, ok := status.FromError(err); !ok || s.Code() != codes.NotFound {
+		t.Errorf("Failed to assign appropriate error code: %s", s.Code())
+	}
+}
+
+func TestMode(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	// Create a server with a mock mode manager
+	manager := NewMockModeManager(ctrl)
+	flipapps := NewServer(context.Background(), "secret", "password", time.Hour, make(chan protos.MessageRequest), nil, manager, nil, nil, nil)
+	// Configure the manager to switch to a known mode, but reject an unknown one
+	gomock.InOrder(
+		manager.EXPECT().SetMode(gomock.Any(), "quote").Return(nil),
+		manager.EXPECT().GetMode(gomock.Any()).Return("quote", []string{"clock", "quote"}, nil),
+		manager.EXPECT().SetMode(gomock.Any(), "weather").Return(mode.ErrModeNotFound),
+	)
+	// Switch mode, and check it is reported
+	_, err := flipapps.SetMode(context.Background(), &protos.SetModeRequest{Name: "quote"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := flipapps.GetMode(context.Background(), &protos.GetModeRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Name != "quote" || !reflect.DeepEqual(response.Available, []string{"clock", "quote"}) {
+		t.Errorf("Unexpected response: %s", response.String())
+	}
+	// Check unknown modes are reported
+	_, err = flipapps.SetMode(context.Background(), &protos.SetModeRequest{Name: "weather"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestPlaylist(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	// Create a server with a mock mode manager
+	manager := NewMockModeManager(ctrl)
+	flipapps := NewServer(context.Background(), "secret", "password", time.Hour, make(chan protos.MessageRequest), nil, manager, nil, nil, nil)
+	// Configure the manager to accept one playlist, but reject another
+	entries := []*protos.Playlist_Entry{{Mode: "clock", Duration: ptypes.DurationProto(time.Minute)}}
+	gomock.InOrder(
+		manager.EXPECT().SetPlaylist(gomock.Any(), entries).Return(nil),
+		manager.EXPECT().GetPlaylist(gomock.Any()).Return(entries, nil),
+		manager.EXPECT().SetPlaylist(gomock.Any(), gomock.Any()).Return(fmt.Errorf("Playlist cannot be empty")),
+	)
+	// Replace the playlist, and check it is reported
+	_, err := flipapps.SetPlaylist(context.Background(), &protos.Playlist{Entries: entries})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := flipapps.GetPlaylist(context.Background(), &protos.GetPlaylistRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(response.Entries, entries) {
+		t.Errorf("Unexpected response: %s", response.String())
+	}
+	// Check invalid playlists are reported
+	_, err = flipapps.SetPlaylist(context.Background(), &protos.Playlist{})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestGetEvents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	// Create a server with a mock event source
+	source := NewMockEventSource(ctrl)
+	flipapps := NewServer(context.Background(), "secret", "password", time.Hour, make(chan protos.MessageRequest), nil, nil, source, nil, nil)
+	// Configure the event source to supply a single event
+	events := make(chan *protos.Event, 1)
+	event := &protos.Event{Payload: &protos.Event_QueueLength{QueueLength: 2}}
+	events <- event
+	unsubscribed := false
+	source.EXPECT().SubscribeEvents().Return(events, func() { unsubscribed = true })
+	// Expect the event to be streamed, and then the client to go away
+	ctx, cancel := getContext()
+	stream := protos.NewMockApp_GetEventsServer(ctrl)
+	stream.EXPECT().Context().Return(ctx).AnyTimes()
+	stream.EXPECT().Send(event).Do(func(*protos.Event) { cancel() }).Return(nil)
+	// Run the command
+	err := flipapps.GetEvents(&protos.EventsRequest{}, stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !unsubscribed {
+		t.Error("Failed to unsubscribe from events")
+	}
+}
+
+func TestGetEventsShutdown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	// Create a server that is already shutting down
+	shutdown, stop := context.WithCancel(context.Background())
+	stop()
+	source := NewMockEventSource(ctrl)
+	flipapps := NewServer(shutdown, "secret", "password", time.Hour, make(chan protos.MessageRequest), nil, nil, source, nil, nil)
+	source.EXPECT().SubscribeEvents().Return(make(chan *protos.Event), func() {})
+	// Check the stream ends, though the client is still there
+	stream := protos.NewMockApp_GetEventsServer(ctrl)
+	stream.EXPECT().Context().Return(context.Background()).AnyTimes()
+	err := flipapps.GetEvents(&protos.EventsRequest{}, stream)
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestGetFrameUpdates(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	// Create a server with a mock event source and sign controller
+	eventSource := NewMockEventSource(ctrl)
+	signController := NewMockSignController(ctrl)
+	flipapps := NewServer(context.Background(), "secret", "password", time.Hour, make(chan protos.MessageRequest), nil, nil, eventSource, signController, nil)
+	// Configure the event source to supply an unrelated event, then a new frame
+	current := &protos.Frame{}
+	drawn := &protos.Frame{Signs: []*protos.Frame_SignImage{{Sign: "test1", Image: &protos.Image{Data: []bool{true}}}}}
+	events := make(chan *protos.Event, 2)
+	events <- &protos.Event{Payload: &protos.Event_QueueLength{QueueLength: 2}}
+	events <- &protos.Event{Payload: &protos.Event_FrameDrawn{FrameDrawn: drawn}}
+	eventSource.EXPECT().SubscribeEvents().Return(events, func() {})
+	signController.EXPECT().Frame().Return(current)
+	// Expect the current frame, followed by the new one, before the client goes away
+	ctx, cancel := getContext()
+	stream := protos.NewMockApp_GetFrameUpdatesServer(ctrl)
+	stream.EXPECT().Context().Return(ctx).AnyTimes()
+	gomock.InOrder(
+		stream.EXPECT().Send(current).Return(nil),
+		stream.EXPECT().Send(drawn).Do(func(*protos.Frame) { cancel() }).Return(nil),
+	)
+	// Run the command
+	err := flipapps.GetFrameUpdates(&protos.FrameRequest{}, stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetFramePacked(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	signController := NewMockSignController(ctrl)
+	signs := []*protos.GetInfoResponse_SignInfo{{Name: "test1", Width: 2, Height: 2}}
+	flipapps := NewServer(context.Background(), "secret", "password", time.Hour, make(chan protos.MessageRequest), nil, nil, nil, signController, signs)
+	// Check the frame is sent as it was drawn, unless bitmaps are requested
+	data := []bool{true, false, false, true}
+	frame := &protos.Frame{Signs: []*protos.Frame_SignImage{{Sign: "test1", Image: &protos.Image{Data: data}}}}
+	signController.EXPECT().Frame().Return(frame).Times(2)
+	response, err := flipapps.GetFrame(context.Background(), &protos.FrameRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response != frame {
+		t.Errorf("Unexpected frame: %s", response.String())
+	}
+	response, err = flipapps.GetFrame(context.Background(), &protos.FrameRequest{Packed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := response.Signs[0].Image
+	if image.Bitmap == nil || image.Data != nil {
+		t.Fatalf("Image not packed: %s", image.String())
+	}
+	pixels, err := bitmap.Pixels(image, bitmap.MaxPixels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pixels, data) {
+		t.Errorf("Unexpected pixels: %v", pixels)
+	}
+}
+
+func TestLight(t *testing.T) {
+	ctrl, flipapps, controller := createSignTestObjects(t)
+	defer ctrl.Finish()
+	// Configure the controller to expect the light to be turned on, then off
+	gomock.InOrder(
+		controller.EXPECT().LightOn().Return(nil),
+		controller.EXPECT().IsLightOn().Return(true),
+		controller.EXPECT().LightOff().Return(fmt.Errorf("Driver unavailable")),
+		controller.EXPECT().LightOn().Return(client.ErrUnsupported),
+	)
+	// Turn the light on, and check it is reported as on
+	_, err := flipapps.Light(context.Background(), &protos.LightRequest{Status: protos.LightRequest_ON})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := flipapps.GetLight(context.Background(), &protos.GetLightRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !response.On {
+		t.Error("Light not reported as on")
+	}
+	// Check driver errors are reported
+	_, err = flipapps.Light(context.Background(), &protos.LightRequest{Status: protos.LightRequest_OFF})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	// Check drivers without a light are reported
+	_, err = flipapps.Light(context.Background(), &protos.LightRequest{Status: protos.LightRequest_ON})
+	if status.Code(err) != codes.Unimplemented {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	// Check unspecified statuses are rejected
+	_, err = flipapps.Light(context.Background(), &protos.LightRequest{})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestTest(t *testing.T) {
+	ctrl, flipapps, controller := createSignTestObjects(t)
+	defer ctrl.Finish()
+	// Configure the controller to expect the test to be started, then stopped
+	gomock.InOrder(
+		controller.EXPECT().TestStart().Return(nil),
+		controller.EXPECT().TestStop().Return(nil),
+	)
+	// Run the commands
+	for _, action := range []protos.TestRequest_Action{protos.TestRequest_START, protos.TestRequest_STOP} {
+		_, err := flipapps.Test(context.Background(), &protos.TestRequest{Action: action})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Check unspecified actions are rejected
+	_, err := flipapps.Test(context.Background(), &protos.TestRequest{})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestFailedMessages(t *testing.T) {
+	ctrl, flipapps, manager := createQueueTestObjects(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+	// Configure the manager with a failed message
+	failed := []*protos.FailedMessage{{Message: &protos.QueuedMessage{Id: 3}, Error: "Unknown glyph"}}
+	manager.EXPECT().ListFailedMessages(gomock.Any()).Return(failed, nil)
+	manager.EXPECT().RetryFailedMessage(gomock.Any(), uint64(3)).Return(nil)
+	manager.EXPECT().DeleteFailedMessage(gomock.Any(), uint64(4)).Return(queue.ErrMessageNotFound)
+	// Check the failed messages are listed
+	response, err := flipapps.ListFailedMessages(ctx, &protos.ListFailedMessagesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Messages) != 1 || response.Messages[0].Error != "Unknown glyph" {
+		t.Errorf("Unexpected failed messages: %s", response.String())
+	}
+	// Check a message can be retried
+	_, err = flipapps.RetryFailedMessage(ctx, &protos.RetryFailedMessageRequest{Id: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Check missing messages are reported
+	_, err = flipapps.DeleteFailedMessage(ctx, &protos.DeleteFailedMessageRequest{Id: 4})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestDriverHealth(t *testing.T) {
+	ctrl, flipapps, controller := createSignTestObjects(t)
+	defer ctrl.Finish()
+	// Configure the controller to report the driver is unreachable
+	controller.EXPECT().Health().Return(&protos.DriverHealth{Healthy: false, Error: "connection refused"})
+	// Check the health is reported
+	response, err := flipapps.GetDriverHealth(context.Background(), &protos.GetDriverHealthRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Healthy || response.Error != "connection refused" {
+		t.Errorf("Unexpected health: %s", response.String())
+	}
+}
+
 // Helper function to set up the unit under test
 func createTestObjects(t *testing.T) (protos.AppServer, chan protos.MessageRequest, []*protos.GetInfoResponse_SignInfo) {
 	// Make some dummy signs
@@ -113,10 +617,26 @@ func createTestObjects(t *testing.T) (protos.AppServer, chan protos.MessageReque
 	// Make a channel for sending messages
 	messageQueue := make(chan protos.MessageRequest, 10)
 	// Create object under test
-	server := NewServer("secret", "password", time.Hour, messageQueue, signs)
+	server := NewServer(context.Background(), "secret", "password", time.Hour, messageQueue, nil, nil, nil, nil, signs)
 	return server, messageQueue, signs
 }
 
+// Helper function to set up the unit under test with a mock queue manager
+func createQueueTestObjects(t *testing.T) (*gomock.Controller, protos.AppServer, *MockQueueManager) {
+	ctrl := gomock.NewController(t)
+	manager := NewMockQueueManager(ctrl)
+	server := NewServer(context.Background(), "secret", "password", time.Hour, make(chan protos.MessageRequest), manager, nil, nil, nil, nil)
+	return ctrl, server, manager
+}
+
+// Helper function to set up the unit under test with a mock sign controller
+func createSignTestObjects(t *testing.T) (*gomock.Controller, protos.AppServer, *MockSignController) {
+	ctrl := gomock.NewController(t)
+	controller := NewMockSignController(ctrl)
+	server := NewServer(context.Background(), "secret", "password", time.Hour, make(chan protos.MessageRequest), nil, nil, nil, controller, nil)
+	return ctrl, server, controller
+}
+
 // Helper function to check that no messages were queued by the server
 func checkNoMessages(t *testing.T, queue chan protos.MessageRequest) {
 	// Check no messages were sent
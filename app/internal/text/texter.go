@@ -26,80 +26,134 @@ func NewFace(data []byte, points float64) (font.Face, error) {
 	return truetype.NewFace(font, &opts), nil
 }
 
+// Dimensions of a sign that text is drawn on
+type Size struct {
+	Width  uint
+	Height uint
+}
+
 type TextBuilder interface {
 	Images(text string, centre bool) ([]draw.Image, error)
+	Blank(position int) draw.Image
 }
 
-func NewTextBuilder(width uint, height uint, font font.Face) TextBuilder {
+// Create a builder for text spread across signs of the specified sizes, in the order they are drawn
+func NewTextBuilder(sizes []Size, font font.Face) TextBuilder {
 	// Create and return a textBuilder
 	return &textBuilder{
-		width:  width,
-		height: height,
-		font:   font,
+		sizes: sizes,
+		font:  font,
+	}
+}
+
+// Create a builder for text on a single canvas, stacking as many lines on each image as fit
+func NewCanvasTextBuilder(size Size, font font.Face) TextBuilder {
+	return &textBuilder{
+		sizes:   []Size{size},
+		font:    font,
+		stacked: true,
 	}
 }
 
 type textBuilder struct {
-	width  uint
-	height uint
-	font   font.Face
+	sizes   []Size
+	font    font.Face
+	stacked bool
 }
 
+// Get images of the text, one line per image, each sized for the sign it will be shown on
 func (tb *textBuilder) Images(text string, centre bool) ([]draw.Image, error) {
 	// Split the string up into lines (convert to uppercase)
 	lines, err := tb.toLines(strings.ToUpper(text))
-	errorHandler(err)
+	if err != nil {
+		return nil, err
+	}
 
 	// Create a drawer from the font
 	d, err := createDrawer(tb.font)
-	errorHandler(err)
+	if err != nil {
+		return nil, err
+	}
 	// Check font metrics
 	m := d.Face.Metrics()
 	charHeight := m.Ascent + m.Descent
-	if charHeight.Floor() > int(tb.height) {
-		return nil, fmt.Errorf("Font height %d larger than height %d", charHeight.Round(), tb.height)
+	for _, size := range tb.sizes {
+		if charHeight.Floor() > int(size.Height) {
+			return nil, fmt.Errorf("Font height %d larger than height %d", charHeight.Round(), size.Height)
+		}
 	}
 	// Draw the string
 	var images []draw.Image
-	for _, line := range lines {
+	lineHeight := charHeight.Ceil()
+	row := 0
+	for i, line := range lines {
+		size := tb.size(i)
 		var xPos fixed.Int26_6 = 0
 		if centre {
 			lineWidth := d.MeasureString(line)
-			xPos = (fixed.I(int(tb.width)) - lineWidth) / 2
+			xPos = (fixed.I(int(size.Width)) - lineWidth) / 2
 		}
-		// Reset the x position
-		d.Dot = fixed.Point26_6{X: xPos, Y: m.Ascent}
-		// Create a fresh destination
-		d.Dst = image.NewGray(image.Rect(0, 0, int(tb.width), int(tb.height)))
-		// Draw a new image
+		if !tb.stacked || row == 0 || (row+1)*lineHeight > int(size.Height) {
+			// Create a fresh destination
+			d.Dst = image.NewGray(image.Rect(0, 0, int(size.Width), int(size.Height)))
+			images = append(images, d.Dst)
+			row = 0
+		}
+		// Reset the position, beneath any lines already on the image
+		d.Dot = fixed.Point26_6{X: xPos, Y: m.Ascent + fixed.I(row*lineHeight)}
+		// Draw the line
 		d.DrawString(line)
-		// Save the image
-		images = append(images, d.Dst)
+		row++
 	}
 	return images, nil
 }
 
-// Wrap text to multiple lines based off font and pixel width
+// Get a blank image for the sign at the specified position in a frame
+func (tb *textBuilder) Blank(position int) draw.Image {
+	size := tb.size(position)
+	return image.NewGray(image.Rect(0, 0, int(size.Width), int(size.Height)))
+}
+
+// Get the size of the sign that shows the image at the specified position
+func (tb *textBuilder) size(position int) Size {
+	return tb.sizes[position%len(tb.sizes)]
+}
+
+// Wrap text to multiple lines based off font and the pixel width of the sign each line is shown on
 func (tb *textBuilder) toLines(s string) ([]string, error) {
+	var lines []string
+	for _, paragraph := range strings.Split(s, "\n") {
+		for {
+			// Fit as much of the paragraph as possible on the next sign
+			line := tb.firstLine(paragraph, tb.size(len(lines)).Width)
+			lines = append(lines, line)
+			remainder := strings.TrimLeft(strings.TrimPrefix(strings.TrimLeft(paragraph, " "), line), " ")
+			if remainder == "" || len(remainder) == len(paragraph) {
+				// The paragraph is complete (or cannot be split any further)
+				break
+			}
+			paragraph = remainder
+		}
+	}
+	return lines, nil
+}
+
+// Get the first line of a paragraph wrapped to the specified pixel width
+func (tb *textBuilder) firstLine(paragraph string, width uint) string {
 	// Create a frame
 	var frame text.Frame
 	frame.SetFace(tb.font)
-	frame.SetMaxWidth(fixed.I(int(tb.width)))
-	// Update the frame with the new text
+	frame.SetMaxWidth(fixed.I(int(width)))
+	// Update the frame with the paragraph
 	c := frame.NewCaret()
-	c.WriteString(s)
+	c.WriteString(paragraph)
 	c.Close()
 	f := &frame
-	// Get the lines
-	var lines []string
-	for p := f.FirstParagraph(); p != nil; p = p.Next(f) {
-		for l := p.FirstLine(f); l != nil; l = l.Next(f) {
-			for b := l.FirstBox(f); b != nil; b = b.Next(f) {
-				lines = append(lines, string(b.TrimmedText(f)[:]))
-			}
-		}
+	// Get the first line
+	if b := f.FirstParagraph().FirstLine(f).FirstBox(f); b != nil {
+		return string(b.TrimmedText(f)[:])
 	}
-	return lines, nil
+	return ""
 }
 
 func createDrawer(face font.Face) (*font.Drawer, error) {
@@ -112,9 +166,3 @@ func createDrawer(face font.Face) (*font.Drawer, error) {
 		Dot:  fixed.Point26_6{X: 0, Y: m.Ascent},
 	}, nil
 }
-
-func errorHandler(err error) {
-	if err != nil {
-		panic(err)
-	}
-}
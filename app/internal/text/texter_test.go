@@ -24,7 +24,7 @@ func TestNewFace(t *testing.T) {
 func TestToToLines(t *testing.T) {
 	// Get test font
 	f := getFont()
-	tb, ok := NewTextBuilder(140, 17, f).(*textBuilder)
+	tb, ok := NewTextBuilder([]Size{{Width: 140, Height: 17}}, f).(*textBuilder)
 	if !ok {
 		t.Fatal("TextBuilder is not a textBuilder")
 	}
@@ -41,6 +41,7 @@ func TestToToLines(t *testing.T) {
 			[]string{"This is a really", "really long", "string, maybe;", "it's four lines"},
 		},
 		{"This string\nhas\nnewlines.", []string{"This string", "has", "newlines."}},
+		{"", []string{""}},
 	}
 
 	for _, table := range tables {
@@ -56,11 +57,57 @@ func TestToToLines(t *testing.T) {
 	}
 }
 
+func TestToLinesMixedWidths(t *testing.T) {
+	// Create a text builder for a narrow sign above a wide one
+	tb, ok := NewTextBuilder([]Size{{Width: 80, Height: 17}, {Width: 160, Height: 17}}, getFont()).(*textBuilder)
+	if !ok {
+		t.Fatal("TextBuilder is not a textBuilder")
+	}
+	// Check each line is wrapped to the sign it will be shown on
+	lines, err := tb.toLines("This is a really really long string")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"This is a", "really really long", "string"}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("toLines failed to split: %v", lines)
+	}
+}
+
+func TestImagesMixedSizes(t *testing.T) {
+	// Create a text builder for signs of different sizes
+	sizes := []Size{{Width: 84, Height: 17}, {Width: 96, Height: 20}}
+	tb := NewTextBuilder(sizes, getFont())
+	images, err := tb.Images("This is a multi-line string", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Check the images alternate between the sign sizes
+	if len(images) != 3 {
+		t.Fatalf("Incorrect number of images: %d", len(images))
+	}
+	for i, img := range images {
+		size := sizes[i%len(sizes)]
+		if img.Bounds().Dx() != int(size.Width) || img.Bounds().Dy() != int(size.Height) {
+			t.Errorf("Image %d has unexpected size: %v", i, img.Bounds())
+		}
+	}
+	// Check blank images are sized for the requested sign
+	if blank := tb.Blank(3); blank.Bounds().Dx() != 96 || blank.Bounds().Dy() != 20 {
+		t.Errorf("Blank image has unexpected size: %v", blank.Bounds())
+	}
+	// Check signs too short for the font are rejected
+	tb = NewTextBuilder([]Size{{Width: 84, Height: 17}, {Width: 84, Height: 7}}, getFont())
+	if _, err := tb.Images("hello", true); err == nil {
+		t.Error("Font taller than sign not rejected")
+	}
+}
+
 func TestImages(t *testing.T) {
 	// Get test font
 	f := getFont()
 	// Create the text builder
-	tb := NewTextBuilder(120, 17, f)
+	tb := NewTextBuilder([]Size{{Width: 120, Height: 17}}, f)
 	images, err := tb.Images("Hello my name is Sam. How's tricks?", false)
 	if err != nil {
 		t.Fatalf("Image conversion returned error: %s", err)
@@ -75,12 +122,36 @@ func TestImages(t *testing.T) {
 	}
 }
 
+func TestImagesCanvas(t *testing.T) {
+	// Get test font
+	f := getFont()
+	// Create a text builder for a canvas two lines tall
+	tb := NewCanvasTextBuilder(Size{Width: 120, Height: 34}, f)
+	images, err := tb.Images("Hello my name is Sam. How's tricks?", false)
+	if err != nil {
+		t.Fatalf("Image conversion returned error: %s", err)
+	} else if len(images) != 2 {
+		t.Fatalf("Incorrect number of images: %d", len(images))
+	}
+	// Check the second line was drawn beneath the first
+	drawn := false
+	for i, pixel := range images[0].(*image.Gray).Pix {
+		drawn = drawn || (i >= 120*17 && pixel != 0)
+	}
+	if !drawn {
+		t.Error("Second line not drawn on first image")
+	}
+	if !checkImage(images[1]) {
+		t.Error("Image empty")
+	}
+}
+
 func TestCentring(t *testing.T) {
 	// Get test font
 	f := getFont()
 	// Create the text builder
 	var width uint = 20
-	tb := NewTextBuilder(width, 17, f)
+	tb := NewTextBuilder([]Size{{Width: width, Height: 17}}, f)
 	// Write a vertical pipe (should be first pixels)
 	images, err := tb.Images("|", false)
 	if err != nil {
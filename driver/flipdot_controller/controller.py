@@ -35,6 +35,7 @@ class FlipdotController:
         self.sign_controller = HanoverController(self.port)
 
         # Create signs
+        self.flipped = any(sign_config.flip for sign_config in signs)
         for sign_config in signs:
             config = sign_config._asdict()
             name = config.pop("name")
@@ -73,6 +74,14 @@ class FlipdotController:
                                   height=query_sign.height)
         return list(info.values()) if sign is None else info[sign]
 
+    def is_flipped(self) -> bool:
+        """Check if any of the signs are flipped to suit how they are mounted
+
+        Returns:
+            bool: True if at least one sign is flipped
+        """
+        return self.flipped
+
     def draw(self, sign: str, image: np.ndarray):
         """Draw the image on the sign
 
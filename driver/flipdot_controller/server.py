@@ -7,6 +7,7 @@ import grpc
 import numpy as np
 from grpc_reflection.v1alpha import reflection
 
+from flipdot_controller import __version__
 from flipdot_controller.controller import FlipdotController
 from flipdot_controller.protos.driver_pb2 import (DESCRIPTOR, DrawResponse,
                                                    GetInfoResponse,
@@ -83,6 +84,12 @@ class Servicer(DriverServicer):
             sign.name = sign_info.name
             sign.width = sign_info.width
             sign.height = sign_info.height
+        # Report what we can do, so clients don't repeat it (e.g. flipping)
+        capabilities = [GetInfoResponse.LIGHT, GetInfoResponse.TEST]  # noqa pylint: disable=E1101
+        if self.controller.is_flipped():
+            capabilities.append(GetInfoResponse.FLIP)  # noqa pylint: disable=E1101
+        response.capabilities.extend(capabilities)  # pylint: disable=E1101
+        response.version = __version__
         return response
 
     def Draw(self, request, context) -> DrawResponse:
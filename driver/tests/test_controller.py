@@ -51,6 +51,13 @@ def test_get_specific_info(controller):
     assert sign.height == 8
 
 
+def test_is_flipped(controller, pins, port):
+    assert controller.is_flipped()
+    # Check signs that aren't flipped aren't reported
+    signs = [SignConfig(name='a', address=1, width=10, height=8, flip=False)]
+    assert not FlipdotController(port=port, signs=signs, pins=pins).is_flipped()
+
+
 def test_start_test(controller, port):
     # Send the start command
     controller.test(True)
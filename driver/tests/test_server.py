@@ -7,7 +7,9 @@ import numpy as np
 import pytest
 
 from flipdot_controller.controller import SignInfo
-from flipdot_controller.protos.driver_pb2 import (DrawRequest, Image,
+from flipdot_controller import __version__
+from flipdot_controller.protos.driver_pb2 import (DrawRequest,
+                                                   GetInfoResponse, Image,
                                                    LightRequest, TestRequest)
 from flipdot_controller.server import Servicer
 
@@ -68,6 +70,19 @@ def test_get_info(servicer, controller):
         assert actual.height == expected.height
 
 
+@pytest.mark.parametrize("flipped", [True, False])
+def test_get_info_capabilities(servicer, controller, flipped):
+    controller.get_info.return_value = []
+    controller.is_flipped.return_value = flipped
+    # Send the request
+    response = servicer.GetInfo(None, None)
+    # Assert flipping is only reported if signs are flipped
+    assert GetInfoResponse.LIGHT in response.capabilities
+    assert GetInfoResponse.TEST in response.capabilities
+    assert (GetInfoResponse.FLIP in response.capabilities) == flipped
+    assert response.version == __version__
+
+
 def test_draw(servicer, controller):
     # Create a fake sign to return
     controller.get_info.return_value = SignInfo(name='test', width=3, height=2)